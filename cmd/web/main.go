@@ -1,20 +1,72 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/aliatli/reactor/examples/primitives"
 	"github.com/aliatli/reactor/internal/api"
+	"github.com/aliatli/reactor/internal/core"
 	"github.com/aliatli/reactor/internal/db"
+	"github.com/aliatli/reactor/internal/executor"
 )
 
+// minLease is the shortest lease workers may hold on a run step
+const minLease = time.Second
+
 func main() {
+	workers := flag.Int("workers", 8, "number of workers executing runs")
+	lease := flag.Duration("lease", 30*time.Second, "how long a worker owns a run step before another worker may take it over")
+	flag.Parse()
+	if *workers < 1 {
+		log.Fatal("workers must be positive")
+	}
+	// Leases are renewed a few times per lease, which needs some slack
+	if *lease < minLease {
+		log.Fatalf("lease must be at least %s", minLease)
+	}
+
 	database, err := db.NewDatabase()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	server := api.NewServer(database)
+	chainExecutor := executor.NewPrimitiveChainExecutor()
+	primitives.RegisterPrimitives(chainExecutor.PrimitiveRegistry)
+
+	// Fail payments fast while the payment gateway is down instead of having
+	// every run wait on it
+	err = chainExecutor.SetCircuitBreaker("processPayment", executor.BreakerConfig{
+		FailureRate:    0.5,
+		MinCalls:       10,
+		Window:         core.Duration(time.Minute),
+		OpenDuration:   core.Duration(30 * time.Second),
+		HalfOpenProbes: 3,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The shipping provider allows 20 requests per second across both calls
+	err = chainExecutor.SetLimit(executor.LimitConfig{Rate: 20, Burst: 20}, "generateShippingLabel", "shipOrder")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := api.NewServer(database, chainExecutor)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := server.ResumeRuns(); err != nil {
+		log.Fatal(err)
+	}
+	go runScheduler(server)
+
+	pool := &workerPool{server: server, database: database, size: *workers, lease: *lease}
+	pool.start()
+	server.Router().HandleFunc("/api/queue", pool.handleStatus).Methods("GET", "OPTIONS")
 
 	log.Println("Starting server on :8080")
 	if err := http.ListenAndServe(":8080", server.Router()); err != nil {
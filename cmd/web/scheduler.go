@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/aliatli/reactor/internal/api"
+)
+
+// wakeupInterval is how often the scheduler looks for timers that fired
+const wakeupInterval = time.Second
+
+// runScheduler resumes waiting runs as their timers fire. Wakeups live in the
+// database, so timers that fired while the server was down run on the first tick.
+func runScheduler(server *api.Server) {
+	ticker := time.NewTicker(wakeupInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := server.WakeRuns(now); err != nil {
+			log.Printf("Error waking runs: %v", err)
+		}
+	}
+}
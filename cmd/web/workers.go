@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/aliatli/reactor/internal/api"
+	"github.com/aliatli/reactor/internal/db"
+	"github.com/aliatli/reactor/internal/models"
+)
+
+// pollInterval is how long an idle worker waits before looking for steps again
+const pollInterval = 200 * time.Millisecond
+
+// workerPool executes queued run steps on a fixed number of workers, so a
+// burst of runs waits in the queue instead of all executing at once
+type workerPool struct {
+	server   *api.Server
+	database *db.Database
+	size     int
+	lease    time.Duration
+	// busy counts the workers executing a step
+	busy atomic.Int64
+}
+
+func (p *workerPool) start() {
+	// Owners are unique per process so a restarted server does not mistake
+	// the leases of its previous life for its own
+	host, _ := os.Hostname()
+	for i := 0; i < p.size; i++ {
+		go p.work(fmt.Sprintf("%s-%d-%d", host, os.Getpid(), i))
+	}
+}
+
+func (p *workerPool) work(owner string) {
+	for {
+		step, err := p.server.ClaimStep(owner, p.lease)
+		if err != nil {
+			log.Printf("Worker %s: error claiming step: %v", owner, err)
+		}
+		if step == nil {
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		p.execute(owner, step)
+	}
+}
+
+// execute runs one claimed step. ExecuteStep fails runs that panic; the
+// recover here only keeps the worker alive if failing the run panics too.
+func (p *workerPool) execute(owner string, step *models.RunStep) {
+	p.busy.Add(1)
+	defer p.busy.Add(-1)
+	defer func() {
+		if value := recover(); value != nil {
+			log.Printf("Worker %s: panic executing run %d: %v", owner, step.RunID, value)
+		}
+	}()
+
+	if err := p.server.ExecuteStep(step, p.lease); err != nil {
+		log.Printf("Worker %s: error executing run %d: %v", owner, step.RunID, err)
+	}
+}
+
+// handleStatus reports the queue depth and how many workers are busy
+func (p *workerPool) handleStatus(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET /api/queue - Fetching queue status")
+
+	ready, leased, err := p.database.GetQueueStats(time.Now())
+	if err != nil {
+		log.Printf("Error fetching queue stats: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	busy := p.busy.Load()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"depth":       ready,
+		"leased":      leased,
+		"workers":     p.size,
+		"busy":        busy,
+		"utilization": float64(busy) / float64(p.size),
+	})
+}
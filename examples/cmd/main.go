@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aliatli/reactor/examples/primitives"
 	"github.com/aliatli/reactor/internal/core"
@@ -26,31 +28,58 @@ func main() {
 			},
 		},
 		MainAction: "processPayment",
+		MainActionOptions: &core.PrimitiveOptions{
+			Timeout:      core.Duration(5 * time.Second),
+			Compensation: "refundPayment",
+		},
+		Timeout: core.Duration(30 * time.Second),
+		Transitions: core.Transitions{
+			core.OutcomeSuccess: "OrderFulfillment",
+			core.OutcomeFailure: "OrderCancelled",
+		},
 	}
-	orderReceivedState.Transitions.Success = "OrderFulfillment"
-	orderReceivedState.Transitions.Failure = "OrderCancelled"
 
 	orderFulfillmentState := core.StateDefinition{
 		Name: "OrderFulfillment",
 		PreliminaryActions: []core.PrimitiveChain{
+			// Allocation and label generation are independent and run concurrently
 			{
 				Primitives:     []string{"allocateInventory"},
 				ExecutionOrder: 1,
+				Options: map[string]core.PrimitiveOptions{
+					"allocateInventory": {Compensation: "releaseInventory"},
+				},
 			},
 			{
 				Primitives:     []string{"generateShippingLabel"},
-				ExecutionOrder: 2,
+				ExecutionOrder: 1,
 			},
 		},
 		MainAction: "shipOrder",
+		Transitions: core.Transitions{
+			core.OutcomeSuccess: "OrderCompleted",
+			core.OutcomeFailure: "CustomerServiceReview",
+		},
 	}
-	orderFulfillmentState.Transitions.Success = "OrderCompleted"
-	orderFulfillmentState.Transitions.Failure = "CustomerServiceReview"
 
 	// Register states
 	stateExecutor.StateDefinitions["OrderReceived"] = orderReceivedState
 	stateExecutor.StateDefinitions["OrderFulfillment"] = orderFulfillmentState
 
+	// Register terminal states
+	stateExecutor.StateDefinitions["OrderCompleted"] = core.StateDefinition{
+		Name:     "OrderCompleted",
+		Terminal: core.TerminalSuccess,
+	}
+	stateExecutor.StateDefinitions["OrderCancelled"] = core.StateDefinition{
+		Name:     "OrderCancelled",
+		Terminal: core.TerminalFailure,
+	}
+	stateExecutor.StateDefinitions["CustomerServiceReview"] = core.StateDefinition{
+		Name:     "CustomerServiceReview",
+		Terminal: core.TerminalFailure,
+	}
+
 	// Create sample order data
 	sampleOrder := map[string]interface{}{
 		"id":     "ORD-12345",
@@ -76,46 +105,41 @@ func main() {
 		},
 	}
 
-	// Create execution context
-	context := core.NewExecutionContext()
-	context.Data["order"] = sampleOrder
+	// Create execution context, bounding the whole run to a minute
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	execCtx := core.NewExecutionContext()
+	execCtx.Set("order", sampleOrder)
 
 	// Process the order through states
-	currentState := "OrderReceived"
-	fmt.Printf("Starting state machine with state: %s\n", currentState)
-
-	for {
-		fmt.Printf("\nExecuting state: %s\n", currentState)
-		nextState, err := stateExecutor.ExecuteState(currentState, context)
-		if err != nil {
-			log.Fatalf("Error executing state %s: %v", currentState, err)
+	runner := executor.NewFlowRunner(stateExecutor)
+	startState := "OrderReceived"
+	fmt.Printf("Starting state machine with state: %s\n", startState)
+
+	result := runner.Run(ctx, startState, execCtx)
+
+	fmt.Printf("\nState path: %v\n", result.Path)
+	fmt.Printf("Context data:\n")
+	printRelevantContextData(execCtx)
+
+	switch result.Status {
+	case executor.RunStatusCompleted:
+		fmt.Printf("\nOrder successfully completed at state: %s\n", result.FinalState)
+	default:
+		if result.Error != nil {
+			log.Printf("Run error: %v", result.Error)
 		}
-
-		// Print relevant context data for debugging
-		fmt.Printf("State execution completed. Context data:\n")
-		printRelevantContextData(context)
-
-		if nextState == "" {
-			fmt.Printf("\nState machine completed at state: %s\n", currentState)
-			break
-		}
-
-		if nextState == "OrderCancelled" || nextState == "CustomerServiceReview" {
-			fmt.Printf("\nOrder requires attention: %s\n", nextState)
-			break
+		for _, compensation := range result.Compensations {
+			fmt.Printf("Compensated %s with %s (success: %t)\n", compensation.Primitive, compensation.Compensation, compensation.Success)
 		}
-
-		if nextState == "OrderCompleted" {
-			fmt.Printf("\nOrder successfully completed!\n")
-			break
-		}
-
-		currentState = nextState
+		fmt.Printf("\nOrder requires attention: %s\n", result.FinalState)
 	}
 }
 
-func printRelevantContextData(context *core.ExecutionContext) {
+func printRelevantContextData(execCtx *core.ExecutionContext) {
 	relevantKeys := []string{
+		"paymentRefunded",
+		"inventoryReleased",
 		"orderValidated",
 		"itemsAvailable",
 		"paymentProcessed",
@@ -129,7 +153,7 @@ func printRelevantContextData(context *core.ExecutionContext) {
 	}
 
 	for _, key := range relevantKeys {
-		if value, exists := context.Data[key]; exists {
+		if value, exists := execCtx.Lookup(key); exists {
 			fmt.Printf("- %s: %v\n", key, value)
 		}
 	}
@@ -1,17 +1,35 @@
 package primitives
 
 import (
+	"context"
+
 	"github.com/aliatli/reactor/internal/core"
 )
 
+// AllocateInventory reserves stock for the order's items. A resumed run may
+// call it again for the same order, so the reservation should be keyed by
+// order ID rather than added on top of an existing one.
 type AllocateInventory struct {
 	// You might want to inject an inventory service client here
 	// inventoryService InventoryService
 }
 
-func (a *AllocateInventory) Execute(context *core.ExecutionContext) (*core.PrimitiveResult, error) {
-	order, ok := context.Data["order"].(map[string]interface{})
-	if !ok {
+func (a *AllocateInventory) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "order", Type: core.TypeObject},
+			{Key: "itemsAvailable", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "inventoryAllocated", Type: core.TypeBool},
+			{Key: "allocations", Type: core.TypeObject},
+		},
+	}
+}
+
+func (a *AllocateInventory) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	order, err := core.Get[map[string]interface{}](execCtx, "order")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "invalid order format"},
@@ -19,8 +37,8 @@ func (a *AllocateInventory) Execute(context *core.ExecutionContext) (*core.Primi
 	}
 
 	// Check if inventory was previously verified
-	itemsAvailable, ok := context.Data["itemsAvailable"].(map[string]bool)
-	if !ok {
+	itemsAvailable, err := core.Get[map[string]bool](execCtx, "itemsAvailable")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "inventory check not performed"},
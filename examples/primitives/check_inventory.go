@@ -1,17 +1,32 @@
 package primitives
 
 import (
+	"context"
+
 	"github.com/aliatli/reactor/internal/core"
 )
 
+// CheckInventory only reads stock levels and is safe to run any number of times
 type CheckInventory struct {
 	// You might want to inject a database client or inventory service here
 	// inventoryService InventoryService
 }
 
-func (c *CheckInventory) Execute(context *core.ExecutionContext) (*core.PrimitiveResult, error) {
-	order, ok := context.Data["order"].(map[string]interface{})
-	if !ok {
+func (c *CheckInventory) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "order", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "inventoryChecked", Type: core.TypeBool},
+			{Key: "itemsAvailable", Type: core.TypeObject},
+		},
+	}
+}
+
+func (c *CheckInventory) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	order, err := core.Get[map[string]interface{}](execCtx, "order")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "invalid order format"},
@@ -1,19 +1,35 @@
 package primitives
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/aliatli/reactor/internal/core"
 )
 
+// GenerateShippingLabel creates a label with the carrier. Run twice, it may
+// create two labels; the carrier should void labels that are never shipped.
 type GenerateShippingLabel struct {
 	// You might want to inject a shipping service client here
 	// shippingService ShippingService
 }
 
-func (g *GenerateShippingLabel) Execute(context *core.ExecutionContext) (*core.PrimitiveResult, error) {
-	order, ok := context.Data["order"].(map[string]interface{})
-	if !ok {
+func (g *GenerateShippingLabel) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "order", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "shippingLabelGenerated", Type: core.TypeBool},
+			{Key: "trackingNumber", Type: core.TypeString},
+			{Key: "labelURL", Type: core.TypeString},
+		},
+	}
+}
+
+func (g *GenerateShippingLabel) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	order, err := core.Get[map[string]interface{}](execCtx, "order")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "invalid order format"},
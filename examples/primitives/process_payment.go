@@ -1,17 +1,35 @@
 package primitives
 
 import (
+	"context"
+
 	"github.com/aliatli/reactor/internal/core"
 )
 
+// ProcessPayment charges the order amount. Primitives run at least once, so
+// the charge should carry an idempotency key derived from the order ID to
+// keep a resumed run from charging the customer twice.
 type ProcessPayment struct {
 	// You might want to inject a payment service client here
 	// paymentService PaymentService
 }
 
-func (p *ProcessPayment) Execute(context *core.ExecutionContext) (*core.PrimitiveResult, error) {
-	order, ok := context.Data["order"].(map[string]interface{})
-	if !ok {
+func (p *ProcessPayment) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "order", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "paymentProcessed", Type: core.TypeBool},
+			{Key: "transactionID", Type: core.TypeString},
+			{Key: "amount", Type: core.TypeNumber},
+		},
+	}
+}
+
+func (p *ProcessPayment) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	order, err := core.Get[map[string]interface{}](execCtx, "order")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "invalid order format"},
@@ -28,6 +46,7 @@ func (p *ProcessPayment) Execute(context *core.ExecutionContext) (*core.Primitiv
 
 	// Simulate payment processing
 	// In a real implementation, you would integrate with a payment gateway
+	// and pass ctx to its client so timeouts and cancellation reach the call
 	paymentSuccessful := amount > 0 // Replace with actual payment processing
 
 	result := &core.PrimitiveResult{
@@ -41,6 +60,12 @@ func (p *ProcessPayment) Execute(context *core.ExecutionContext) (*core.Primitiv
 
 	if !paymentSuccessful {
 		result.Data["error"] = "payment failed"
+		// Lets the state route declined payments apart from other failures
+		result.Error = &core.Error{
+			Code:    "PAYMENT_DECLINED",
+			Message: "payment failed",
+			Details: map[string]interface{}{"amount": amount},
+		}
 	}
 
 	return result, nil
@@ -0,0 +1,47 @@
+package primitives
+
+import (
+	"context"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// RefundPayment compensates ProcessPayment when a later step of the order fails.
+// Compensations may run more than once too, so the refund should reuse the
+// charge's transaction ID to stay idempotent.
+type RefundPayment struct {
+	// You might want to inject a payment service client here
+	// paymentService PaymentService
+}
+
+func (r *RefundPayment) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "transactionID", Type: core.TypeString},
+		},
+		Outputs: []core.Field{
+			{Key: "paymentRefunded", Type: core.TypeBool},
+			{Key: "refundID", Type: core.TypeString},
+		},
+	}
+}
+
+func (r *RefundPayment) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	transactionID, err := core.Get[string](execCtx, "transactionID")
+	if err != nil {
+		return &core.PrimitiveResult{
+			Success: false,
+			Data:    map[string]interface{}{"error": "missing transaction id"},
+		}, nil
+	}
+
+	// Simulate the refund
+	// In a real implementation, you would refund the transaction with your payment provider
+	return &core.PrimitiveResult{
+		Success: true,
+		Data: map[string]interface{}{
+			"paymentRefunded": true,
+			"refundID":        "refund_" + transactionID,
+		},
+	}, nil
+}
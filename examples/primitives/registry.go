@@ -12,4 +12,6 @@ func RegisterPrimitives(registry map[string]core.Primitive) {
 	registry["allocateInventory"] = &AllocateInventory{}
 	registry["generateShippingLabel"] = &GenerateShippingLabel{}
 	registry["shipOrder"] = &ShipOrder{}
+	registry["refundPayment"] = &RefundPayment{}
+	registry["releaseInventory"] = &ReleaseInventory{}
 }
@@ -0,0 +1,51 @@
+package primitives
+
+import (
+	"context"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// ReleaseInventory compensates AllocateInventory when a later step of the order
+// fails. Releasing an allocation that is already released is a no-op.
+type ReleaseInventory struct {
+	// You might want to inject an inventory service client here
+	// inventoryService InventoryService
+}
+
+func (r *ReleaseInventory) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "allocations", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "inventoryReleased", Type: core.TypeBool},
+			{Key: "releasedAllocations", Type: core.TypeList},
+		},
+	}
+}
+
+func (r *ReleaseInventory) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	allocations, err := core.Get[map[string]string](execCtx, "allocations")
+	if err != nil {
+		return &core.PrimitiveResult{
+			Success: false,
+			Data:    map[string]interface{}{"error": "missing inventory allocations"},
+		}, nil
+	}
+
+	// Simulate releasing the reserved items
+	// In a real implementation, you would release each allocation in your inventory system
+	released := make([]string, 0, len(allocations))
+	for _, allocationID := range allocations {
+		released = append(released, allocationID)
+	}
+
+	return &core.PrimitiveResult{
+		Success: true,
+		Data: map[string]interface{}{
+			"inventoryReleased":   true,
+			"releasedAllocations": released,
+		},
+	}, nil
+}
@@ -1,28 +1,47 @@
 package primitives
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/aliatli/reactor/internal/core"
 )
 
+// ShipOrder hands the order to the warehouse. After a crash it can run again,
+// notifying the warehouse a second time; the warehouse is expected to ignore
+// shipments it already has for the tracking number.
 type ShipOrder struct {
 	// You might want to inject shipping service client here
 	// shippingService ShippingService
 }
 
-func (s *ShipOrder) Execute(context *core.ExecutionContext) (*core.PrimitiveResult, error) {
+func (s *ShipOrder) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "trackingNumber", Type: core.TypeString},
+			{Key: "allocations", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "shipmentID", Type: core.TypeString},
+			{Key: "shippingStatus", Type: core.TypeString},
+			{Key: "shippedAt", Type: core.TypeString},
+			{Key: "allocations", Type: core.TypeObject},
+		},
+	}
+}
+
+func (s *ShipOrder) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
 	// Verify all required data is present
-	trackingNumber, ok := context.Data["trackingNumber"].(string)
-	if !ok {
+	trackingNumber, err := core.Get[string](execCtx, "trackingNumber")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "missing tracking number"},
 		}, nil
 	}
 
-	allocations, ok := context.Data["allocations"].(map[string]string)
-	if !ok {
+	allocations, err := core.Get[map[string]string](execCtx, "allocations")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "missing inventory allocations"},
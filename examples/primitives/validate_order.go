@@ -1,14 +1,28 @@
 package primitives
 
 import (
+	"context"
+
 	"github.com/aliatli/reactor/internal/core"
 )
 
+// ValidateOrder has no side effects, so re-running it is harmless
 type ValidateOrder struct{}
 
-func (v *ValidateOrder) Execute(context *core.ExecutionContext) (*core.PrimitiveResult, error) {
-	order, ok := context.Data["order"].(map[string]interface{})
-	if !ok {
+func (v *ValidateOrder) Contract() core.Contract {
+	return core.Contract{
+		Inputs: []core.Field{
+			{Key: "order", Type: core.TypeObject},
+		},
+		Outputs: []core.Field{
+			{Key: "orderValidated", Type: core.TypeBool},
+		},
+	}
+}
+
+func (v *ValidateOrder) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	order, err := core.Get[map[string]interface{}](execCtx, "order")
+	if err != nil {
 		return &core.PrimitiveResult{
 			Success: false,
 			Data:    map[string]interface{}{"error": "invalid order format"},
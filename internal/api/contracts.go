@@ -0,0 +1,229 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// contractWarnings lists primitive inputs that no state upstream of their
+// own can have written. Keys read by entry states, the ones no transition
+// leads to, are taken to be the run's input and count as written everywhere.
+// Primitives with an input mapping only need their inputs to be mapped, and
+// outputs placed under a path count as writing its first key. Primitives
+// without a contract are skipped.
+func contractWarnings(states map[string]core.StateDefinition, registry map[string]core.Primitive) []string {
+	contract := func(name string) (core.Contract, bool) {
+		primitive, ok := registry[name].(core.ContractedPrimitive)
+		if !ok {
+			return core.Contract{}, false
+		}
+		return primitive.Contract(), true
+	}
+
+	predecessors := make(map[string][]string)
+	for name, state := range states {
+		for _, target := range successors(state) {
+			predecessors[target] = append(predecessors[target], name)
+		}
+	}
+
+	written := make(map[string]map[string]bool)
+	runInput := make(map[string]bool)
+	for name, state := range states {
+		written[name] = make(map[string]bool)
+		for _, use := range statePrimitives(state) {
+			c, ok := contract(use.name)
+			if !ok {
+				continue
+			}
+			for _, key := range outputKeys(c, use.mapping) {
+				written[name][key] = true
+			}
+			if len(predecessors[name]) == 0 && (use.mapping == nil || use.mapping.Input == nil) {
+				for _, field := range c.Inputs {
+					runInput[field.Key] = true
+				}
+			}
+		}
+		if state.Map != nil {
+			written[name][state.Map.ResultKeyOrDefault()] = true
+		}
+		if state.SubFlow != nil {
+			for key := range state.SubFlow.Output {
+				written[name][key] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		if len(predecessors[name]) == 0 {
+			continue
+		}
+		available := make(map[string]bool)
+		for key := range runInput {
+			available[key] = true
+		}
+		for _, upstream := range ancestors(name, predecessors) {
+			for key := range written[upstream] {
+				available[key] = true
+			}
+		}
+
+		state := states[name]
+		if state.SubFlow != nil {
+			for key := range state.SubFlow.Output {
+				available[key] = true
+			}
+		}
+		check := func(use primitiveUse, local map[string]bool) {
+			c, ok := contract(use.name)
+			if !ok {
+				return
+			}
+			for _, field := range c.Inputs {
+				switch {
+				case field.Optional:
+				case use.mapping != nil && use.mapping.Input != nil:
+					if _, mapped := use.mapping.Input[field.Key]; !mapped {
+						warnings = append(warnings, fmt.Sprintf("state %s: primitive %s reads %s, which its input mapping leaves out", name, use.name, field.Key))
+					}
+				case !available[field.Key] && !local[field.Key]:
+					warnings = append(warnings, fmt.Sprintf("state %s: primitive %s reads %s, which no upstream state writes", name, use.name, field.Key))
+				}
+			}
+		}
+		write := func(use primitiveUse, local map[string]bool) {
+			if c, ok := contract(use.name); ok {
+				for _, key := range outputKeys(c, use.mapping) {
+					local[key] = true
+				}
+			}
+		}
+
+		// Within the state, a primitive sees the writes of earlier primitives in
+		// its chain and of chains with a lower execution order
+		chains := make([]core.PrimitiveChain, len(state.PreliminaryActions))
+		for i, chain := range state.PreliminaryActions {
+			chains[i] = state.MappedChain(chain)
+		}
+		sort.SliceStable(chains, func(i, j int) bool {
+			return chains[i].ExecutionOrder < chains[j].ExecutionOrder
+		})
+		for i := 0; i < len(chains); {
+			group := i
+			for group < len(chains) && chains[group].ExecutionOrder == chains[i].ExecutionOrder {
+				group++
+			}
+			for _, chain := range chains[i:group] {
+				local := make(map[string]bool)
+				for _, primitive := range chain.Primitives {
+					use := primitiveUse{primitive, chain.Options[primitive].DataMapping}
+					check(use, local)
+					write(use, local)
+				}
+			}
+			for _, chain := range chains[i:group] {
+				for _, primitive := range chain.Primitives {
+					write(primitiveUse{primitive, chain.Options[primitive].DataMapping}, available)
+				}
+			}
+			i = group
+		}
+		if state.Map != nil {
+			available[state.Map.ResultKeyOrDefault()] = true
+		}
+		if state.MainAction != "" {
+			check(mainActionUse(state), nil)
+		}
+	}
+	return warnings
+}
+
+// successors lists the states a state can move to
+func successors(state core.StateDefinition) []string {
+	var targets []string
+	for _, target := range state.Transitions {
+		if target != "" && target != core.NoTransition {
+			targets = append(targets, target)
+		}
+	}
+	for _, target := range state.ErrorTransitions {
+		targets = append(targets, target)
+	}
+	for _, guard := range state.Guards {
+		targets = append(targets, guard.Target)
+	}
+	return append(targets, state.AllowedNextStates...)
+}
+
+// primitiveUse is a primitive run by a state with the data mapping it runs under
+type primitiveUse struct {
+	name    string
+	mapping *core.DataMapping
+}
+
+// statePrimitives lists the primitives a state runs itself
+func statePrimitives(state core.StateDefinition) []primitiveUse {
+	var uses []primitiveUse
+	for _, chain := range state.PreliminaryActions {
+		chain = state.MappedChain(chain)
+		for _, primitive := range chain.Primitives {
+			uses = append(uses, primitiveUse{primitive, chain.Options[primitive].DataMapping})
+		}
+	}
+	if state.MainAction != "" {
+		uses = append(uses, mainActionUse(state))
+	}
+	return uses
+}
+
+func mainActionUse(state core.StateDefinition) primitiveUse {
+	use := primitiveUse{name: state.MainAction, mapping: state.DataMapping}
+	if state.MainActionOptions != nil && state.MainActionOptions.DataMapping != nil {
+		use.mapping = state.MainActionOptions.DataMapping
+	}
+	return use
+}
+
+// outputKeys lists the top-level context keys a primitive writes
+func outputKeys(contract core.Contract, mapping *core.DataMapping) []string {
+	if mapping != nil {
+		if segments, err := mapping.OutputSegments(); err == nil && len(segments) > 0 {
+			return segments[:1]
+		}
+	}
+	keys := make([]string, len(contract.Outputs))
+	for i, field := range contract.Outputs {
+		keys[i] = field.Key
+	}
+	return keys
+}
+
+// ancestors lists the states from which a run can reach name, excluding
+// name itself
+func ancestors(name string, predecessors map[string][]string) []string {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	var result []string
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, predecessor := range predecessors[current] {
+			if !seen[predecessor] {
+				seen[predecessor] = true
+				result = append(result, predecessor)
+				queue = append(queue, predecessor)
+			}
+		}
+	}
+	return result
+}
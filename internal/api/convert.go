@@ -0,0 +1,543 @@
+package api
+
+import (
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+	"github.com/aliatli/reactor/internal/executor"
+	"github.com/aliatli/reactor/internal/models"
+)
+
+// toModelState converts a state definition into its database model
+func toModelState(stateDefinition core.StateDefinition) *models.State {
+	modelChains := make([]models.PrimitiveChain, len(stateDefinition.PreliminaryActions))
+	for i, chain := range stateDefinition.PreliminaryActions {
+		modelChains[i] = toModelChain(chain)
+	}
+
+	modelEdges := make([]models.Edge, len(stateDefinition.Edges))
+	for i, edge := range stateDefinition.Edges {
+		modelEdges[i] = models.Edge{
+			Source:       edge.Source,
+			Target:       edge.Target,
+			SourceHandle: edge.SourceHandle,
+		}
+	}
+
+	return &models.State{
+		Name:               stateDefinition.Name,
+		PreliminaryActions: modelChains,
+		MainAction:         stateDefinition.MainAction,
+		MainActionOptions:  toModelOptions(stateDefinition.MainActionOptions),
+		Timeout:            stateDefinition.Timeout.Duration(),
+		Retry:              toModelRetry(stateDefinition.Retry),
+		Timer:              toModelTimer(stateDefinition.Timer),
+		WaitFor:            toModelWaitFor(stateDefinition.WaitFor),
+		SubFlow:            toModelSubFlow(stateDefinition.SubFlow),
+		Map:                toModelMap(stateDefinition.Map),
+		DataMapping:        toModelDataMapping(stateDefinition.DataMapping),
+		MergeConflicts:     stateDefinition.MergeConflicts,
+		MaxVisits:          stateDefinition.MaxVisits,
+		AllowedNextStates:  stateDefinition.AllowedNextStates,
+		PositionX:          stateDefinition.Position.X,
+		PositionY:          stateDefinition.Position.Y,
+		Terminal:           string(stateDefinition.Terminal),
+		Transitions:        stateDefinition.Transitions,
+		ErrorTransitions:   stateDefinition.ErrorTransitions,
+		Guards:             toModelGuards(stateDefinition.Guards),
+		Edges:              modelEdges,
+	}
+}
+
+// toStateDefinition converts a database model back into a state definition
+func toStateDefinition(state models.State) core.StateDefinition {
+	primitiveChains := make([]core.PrimitiveChain, len(state.PreliminaryActions))
+	for i, chain := range state.PreliminaryActions {
+		primitiveChains[i] = toCoreChain(chain)
+	}
+
+	edges := make([]core.Edge, len(state.Edges))
+	for i, edge := range state.Edges {
+		edges[i] = core.Edge{
+			Source:       edge.Source,
+			Target:       edge.Target,
+			SourceHandle: edge.SourceHandle,
+		}
+	}
+
+	stateDef := core.StateDefinition{
+		Name:               state.Name,
+		PreliminaryActions: primitiveChains,
+		MainAction:         state.MainAction,
+		MainActionOptions:  toCoreOptions(state.MainActionOptions),
+		Timeout:            core.Duration(state.Timeout),
+		Retry:              toCoreRetry(state.Retry),
+		Timer:              toCoreTimer(state.Timer),
+		WaitFor:            toCoreWaitFor(state.WaitFor),
+		SubFlow:            toCoreSubFlow(state.SubFlow),
+		Map:                toCoreMap(state.Map),
+		DataMapping:        toCoreDataMapping(state.DataMapping),
+		MergeConflicts:     state.MergeConflicts,
+		MaxVisits:          state.MaxVisits,
+		AllowedNextStates:  state.AllowedNextStates,
+		Position: core.Position{
+			X: state.PositionX,
+			Y: state.PositionY,
+		},
+		Edges:            edges,
+		Terminal:         core.TerminalKind(state.Terminal),
+		Transitions:      core.Transitions(state.Transitions),
+		ErrorTransitions: state.ErrorTransitions,
+		Guards:           toCoreGuards(state.Guards),
+	}
+	return stateDef
+}
+
+func toModelChain(chain core.PrimitiveChain) models.PrimitiveChain {
+	return models.PrimitiveChain{
+		Primitives:     chain.Primitives,
+		ExecutionOrder: chain.ExecutionOrder,
+		Options:        toModelOptionsMap(chain.Options),
+	}
+}
+
+func toCoreChain(chain models.PrimitiveChain) core.PrimitiveChain {
+	return core.PrimitiveChain{
+		Primitives:     chain.Primitives,
+		ExecutionOrder: chain.ExecutionOrder,
+		Options:        toCoreOptionsMap(chain.Options),
+	}
+}
+
+func toModelGuards(guards []core.Guard) []models.Guard {
+	if guards == nil {
+		return nil
+	}
+	modelGuards := make([]models.Guard, len(guards))
+	for i, guard := range guards {
+		modelGuards[i] = models.Guard(guard)
+	}
+	return modelGuards
+}
+
+func toCoreGuards(guards []models.Guard) []core.Guard {
+	if guards == nil {
+		return nil
+	}
+	coreGuards := make([]core.Guard, len(guards))
+	for i, guard := range guards {
+		coreGuards[i] = core.Guard(guard)
+	}
+	return coreGuards
+}
+
+func toModelOptionsMap(options map[string]core.PrimitiveOptions) map[string]models.PrimitiveOptions {
+	if options == nil {
+		return nil
+	}
+	modelOptions := make(map[string]models.PrimitiveOptions, len(options))
+	for name, option := range options {
+		modelOptions[name] = *toModelOptions(&option)
+	}
+	return modelOptions
+}
+
+func toModelOptions(options *core.PrimitiveOptions) *models.PrimitiveOptions {
+	if options == nil {
+		return nil
+	}
+	return &models.PrimitiveOptions{
+		Timeout:      options.Timeout.Duration(),
+		Retry:        toModelRetry(options.Retry),
+		Compensation: options.Compensation,
+		DataMapping:  toModelDataMapping(options.DataMapping),
+	}
+}
+
+func toCoreOptionsMap(options map[string]models.PrimitiveOptions) map[string]core.PrimitiveOptions {
+	if options == nil {
+		return nil
+	}
+	coreOptions := make(map[string]core.PrimitiveOptions, len(options))
+	for name, option := range options {
+		coreOptions[name] = *toCoreOptions(&option)
+	}
+	return coreOptions
+}
+
+func toCoreOptions(options *models.PrimitiveOptions) *core.PrimitiveOptions {
+	if options == nil {
+		return nil
+	}
+	return &core.PrimitiveOptions{
+		Timeout:      core.Duration(options.Timeout),
+		Retry:        toCoreRetry(options.Retry),
+		Compensation: options.Compensation,
+		DataMapping:  toCoreDataMapping(options.DataMapping),
+	}
+}
+
+func toModelRetry(policy *core.RetryPolicy) *models.RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &models.RetryPolicy{
+		MaxAttempts:        policy.MaxAttempts,
+		InitialInterval:    policy.InitialInterval.Duration(),
+		MaxInterval:        policy.MaxInterval.Duration(),
+		BackoffCoefficient: policy.BackoffCoefficient,
+		Jitter:             policy.Jitter,
+		RetryOn:            policy.RetryOn,
+	}
+}
+
+func toCoreRetry(policy *models.RetryPolicy) *core.RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &core.RetryPolicy{
+		MaxAttempts:        policy.MaxAttempts,
+		InitialInterval:    core.Duration(policy.InitialInterval),
+		MaxInterval:        core.Duration(policy.MaxInterval),
+		BackoffCoefficient: policy.BackoffCoefficient,
+		Jitter:             policy.Jitter,
+		RetryOn:            policy.RetryOn,
+	}
+}
+
+func toModelTimer(timer *core.Timer) *models.Timer {
+	if timer == nil {
+		return nil
+	}
+	return &models.Timer{
+		Delay: timer.Delay.Duration(),
+		Until: timer.Until,
+		Cron:  timer.Cron,
+	}
+}
+
+func toCoreTimer(timer *models.Timer) *core.Timer {
+	if timer == nil {
+		return nil
+	}
+	return &core.Timer{
+		Delay: core.Duration(timer.Delay),
+		Until: timer.Until,
+		Cron:  timer.Cron,
+	}
+}
+
+func toModelWaitFor(wait *core.WaitForSignal) *models.WaitForSignal {
+	if wait == nil {
+		return nil
+	}
+	return &models.WaitForSignal{
+		Signal:  wait.Signal,
+		Timeout: wait.Timeout.Duration(),
+	}
+}
+
+func toCoreWaitFor(wait *models.WaitForSignal) *core.WaitForSignal {
+	if wait == nil {
+		return nil
+	}
+	return &core.WaitForSignal{
+		Signal:  wait.Signal,
+		Timeout: core.Duration(wait.Timeout),
+	}
+}
+
+func toModelSubFlow(subFlow *core.SubFlow) *models.SubFlow {
+	if subFlow == nil {
+		return nil
+	}
+	return &models.SubFlow{
+		StartState: subFlow.StartState,
+		Input:      subFlow.Input,
+		Output:     subFlow.Output,
+	}
+}
+
+func toCoreSubFlow(subFlow *models.SubFlow) *core.SubFlow {
+	if subFlow == nil {
+		return nil
+	}
+	return &core.SubFlow{
+		StartState: subFlow.StartState,
+		Input:      subFlow.Input,
+		Output:     subFlow.Output,
+	}
+}
+
+func toModelFlowSettings(limits core.FlowLimits) *models.FlowSettings {
+	return &models.FlowSettings{
+		MaxVisits:      limits.MaxVisits,
+		MaxTransitions: limits.MaxTransitions,
+	}
+}
+
+func toFlowLimits(settings *models.FlowSettings) core.FlowLimits {
+	return core.FlowLimits{
+		MaxVisits:      settings.MaxVisits,
+		MaxTransitions: settings.MaxTransitions,
+	}
+}
+
+func toModelDataMapping(mapping *core.DataMapping) *models.DataMapping {
+	if mapping == nil {
+		return nil
+	}
+	return &models.DataMapping{
+		Input:      mapping.Input,
+		OutputPath: mapping.OutputPath,
+	}
+}
+
+func toCoreDataMapping(mapping *models.DataMapping) *core.DataMapping {
+	if mapping == nil {
+		return nil
+	}
+	return &core.DataMapping{
+		Input:      mapping.Input,
+		OutputPath: mapping.OutputPath,
+	}
+}
+
+func toModelMap(spec *core.Map) *models.Map {
+	if spec == nil {
+		return nil
+	}
+	modelMap := &models.Map{
+		Items:             spec.Items,
+		ItemKey:           spec.ItemKey,
+		StartState:        spec.StartState,
+		MaxConcurrency:    spec.MaxConcurrency,
+		ToleratedFailures: spec.ToleratedFailures,
+		ResultKey:         spec.ResultKey,
+	}
+	if spec.Chain != nil {
+		chain := toModelChain(*spec.Chain)
+		modelMap.Chain = &chain
+	}
+	return modelMap
+}
+
+func toCoreMap(spec *models.Map) *core.Map {
+	if spec == nil {
+		return nil
+	}
+	coreMap := &core.Map{
+		Items:             spec.Items,
+		ItemKey:           spec.ItemKey,
+		StartState:        spec.StartState,
+		MaxConcurrency:    spec.MaxConcurrency,
+		ToleratedFailures: spec.ToleratedFailures,
+		ResultKey:         spec.ResultKey,
+	}
+	if spec.Chain != nil {
+		chain := toCoreChain(*spec.Chain)
+		coreMap.Chain = &chain
+	}
+	return coreMap
+}
+
+func toModelAttempts(attempts []executor.Attempt) []models.Attempt {
+	modelAttempts := make([]models.Attempt, len(attempts))
+	for i, attempt := range attempts {
+		modelAttempts[i] = models.Attempt(attempt)
+	}
+	return modelAttempts
+}
+
+func toModelRunEvent(runID uint, event executor.Event) *models.RunEvent {
+	return &models.RunEvent{
+		RunID:     runID,
+		Type:      string(event.Type),
+		Time:      event.Time,
+		State:     event.State,
+		Primitive: event.Primitive,
+		Attempt:   event.Attempt,
+		Success:   event.Success,
+		Duration:  event.Duration,
+		Waited:    event.Waited,
+		Data:      event.Data,
+		Error:     event.Error,
+		ErrorCode: event.ErrorCode,
+		Target:    event.Target,
+		Status:    string(event.Status),
+	}
+}
+
+// runEventResponse is the JSON representation of a run event
+type runEventResponse struct {
+	ID uint `json:"id"`
+	executor.Event
+}
+
+func toRunEventResponse(event models.RunEvent) runEventResponse {
+	return runEventResponse{
+		ID: event.ID,
+		Event: executor.Event{
+			Type:      executor.EventType(event.Type),
+			Time:      event.Time,
+			State:     event.State,
+			Primitive: event.Primitive,
+			Attempt:   event.Attempt,
+			Success:   event.Success,
+			Duration:  event.Duration,
+			Waited:    event.Waited,
+			Data:      event.Data,
+			Error:     event.Error,
+			ErrorCode: event.ErrorCode,
+			Target:    event.Target,
+			Status:    executor.RunStatus(event.Status),
+		},
+	}
+}
+
+// runResponse is the JSON representation of a run
+type runResponse struct {
+	ID             uint                    `json:"id"`
+	StartState     string                  `json:"startState"`
+	CurrentState   string                  `json:"currentState"`
+	Status         string                  `json:"status"`
+	Path           []string                `json:"path"`
+	Context        map[string]interface{}  `json:"context"`
+	Attempts       []executor.Attempt      `json:"attempts,omitempty"`
+	Compensations  []executor.Compensation `json:"compensations,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+	Failure        *core.Error             `json:"failure,omitempty"`
+	WakeAt         *time.Time              `json:"wakeAt,omitempty"`
+	ParentRunID    *uint                   `json:"parentRunId,omitempty"`
+	ChildRunIDs    []uint                  `json:"childRunIds,omitempty"`
+	IdempotencyKey *string                 `json:"idempotencyKey,omitempty"`
+	CreatedAt      time.Time               `json:"createdAt"`
+	UpdatedAt      time.Time               `json:"updatedAt"`
+}
+
+func toRunResponse(run models.Run) runResponse {
+	return runResponse{
+		ID:             run.ID,
+		StartState:     run.StartState,
+		CurrentState:   run.CurrentState,
+		Status:         run.Status,
+		Path:           run.Path,
+		Context:        run.Context,
+		Attempts:       toAttempts(run.Attempts),
+		Compensations:  toCompensations(run.Compensations),
+		Error:          run.Error,
+		Failure:        toFailure(run.Failure),
+		WakeAt:         run.WakeAt,
+		ParentRunID:    run.ParentRunID,
+		ChildRunIDs:    run.ChildRunIDs,
+		IdempotencyKey: run.IdempotencyKey,
+		CreatedAt:      run.CreatedAt,
+		UpdatedAt:      run.UpdatedAt,
+	}
+}
+
+func toAttempts(modelAttempts []models.Attempt) []executor.Attempt {
+	attempts := make([]executor.Attempt, len(modelAttempts))
+	for i, attempt := range modelAttempts {
+		attempts[i] = executor.Attempt(attempt)
+	}
+	return attempts
+}
+
+func toModelCompensations(compensations []executor.Compensation) []models.Compensation {
+	modelCompensations := make([]models.Compensation, len(compensations))
+	for i, compensation := range compensations {
+		modelCompensations[i] = models.Compensation(compensation)
+	}
+	return modelCompensations
+}
+
+func toCompensations(modelCompensations []models.Compensation) []executor.Compensation {
+	compensations := make([]executor.Compensation, len(modelCompensations))
+	for i, compensation := range modelCompensations {
+		compensations[i] = executor.Compensation(compensation)
+	}
+	return compensations
+}
+
+func toModelCompletedSteps(steps []executor.CompletedStep) []models.CompletedStep {
+	modelSteps := make([]models.CompletedStep, len(steps))
+	for i, step := range steps {
+		modelSteps[i] = models.CompletedStep(step)
+	}
+	return modelSteps
+}
+
+func toCompletedSteps(modelSteps []models.CompletedStep) []executor.CompletedStep {
+	steps := make([]executor.CompletedStep, len(modelSteps))
+	for i, step := range modelSteps {
+		steps[i] = executor.CompletedStep(step)
+	}
+	return steps
+}
+
+// toCheckpoint rebuilds the checkpoint stored in a run
+func toCheckpoint(run models.Run) *executor.Checkpoint {
+	var wakeAt time.Time
+	if run.WakeAt != nil {
+		wakeAt = *run.WakeAt
+	}
+	return &executor.Checkpoint{
+		State:          run.CurrentState,
+		Path:           run.Path,
+		Data:           run.Context,
+		Attempts:       toAttempts(run.Attempts),
+		CompletedSteps: toCompletedSteps(run.CompletedSteps),
+		LastError:      run.LastError,
+		LastFailure:    toFailure(run.LastFailure),
+		WakeAt:         wakeAt,
+		ReceivedSignal: run.ReceivedSignal,
+		Child:          toChildResult(run.ChildResult),
+	}
+}
+
+func toModelFailure(failure *core.Error) *models.Failure {
+	if failure == nil {
+		return nil
+	}
+	return &models.Failure{
+		Code:      failure.Code,
+		Message:   failure.Message,
+		Transient: failure.Transient,
+		Details:   failure.Details,
+	}
+}
+
+func toFailure(failure *models.Failure) *core.Error {
+	if failure == nil {
+		return nil
+	}
+	return &core.Error{
+		Code:      failure.Code,
+		Message:   failure.Message,
+		Transient: failure.Transient,
+		Details:   failure.Details,
+	}
+}
+
+func toModelChildResult(child *executor.ChildResult) *models.ChildResult {
+	if child == nil {
+		return nil
+	}
+	return &models.ChildResult{
+		Status: string(child.Status),
+		Data:   child.Data,
+		Error:  child.Error,
+	}
+}
+
+func toChildResult(child *models.ChildResult) *executor.ChildResult {
+	if child == nil {
+		return nil
+	}
+	return &executor.ChildResult{
+		Status: executor.RunStatus(child.Status),
+		Data:   child.Data,
+		Error:  child.Error,
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -14,6 +15,8 @@ func (s *Server) handleSaveFlow(w http.ResponseWriter, r *http.Request) {
 	log.Printf("POST /api/flow - Saving flow configuration")
 	var flow struct {
 		States map[string]core.StateDefinition `json:"states"`
+		// Limits are kept as they are when left out
+		Limits *core.FlowLimits `json:"limits"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&flow); err != nil {
@@ -22,52 +25,79 @@ func (s *Server) handleSaveFlow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Save each state to the database
+	if flow.Limits != nil {
+		if err := flow.Limits.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("limits: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
 	for _, stateDefinition := range flow.States {
-		// Convert primitive chains
-		modelChains := make([]models.PrimitiveChain, len(stateDefinition.PreliminaryActions))
-		for i, chain := range stateDefinition.PreliminaryActions {
-			modelChains[i] = models.PrimitiveChain{
-				Primitives:     chain.Primitives,
-				ExecutionOrder: chain.ExecutionOrder,
-			}
+		if err := stateDefinition.Validate(); err != nil {
+			log.Printf("Invalid state %s: %v", stateDefinition.Name, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		// Convert edges
-		modelEdges := make([]models.Edge, len(stateDefinition.Edges))
-		for i, edge := range stateDefinition.Edges {
-			modelEdges[i] = models.Edge{
-				Source:       edge.Source,
-				Target:       edge.Target,
-				SourceHandle: edge.SourceHandle,
+		for _, guard := range stateDefinition.Guards {
+			if _, exists := flow.States[guard.Target]; !exists {
+				http.Error(w, fmt.Sprintf("state %s: guard %q targets unknown state %s", stateDefinition.Name, guard.Expression, guard.Target), http.StatusBadRequest)
+				return
 			}
 		}
-
-		state := &models.State{
-			Name:               stateDefinition.Name,
-			PreliminaryActions: modelChains,
-			MainAction:         stateDefinition.MainAction,
-			PositionX:          stateDefinition.Position.X,
-			PositionY:          stateDefinition.Position.Y,
-			SuccessTransition:  stateDefinition.Transitions.Success,
-			FailureTransition:  stateDefinition.Transitions.Failure,
-			Edges:              modelEdges,
+		if spec := stateDefinition.Map; spec != nil && spec.StartState != "" {
+			if _, exists := flow.States[spec.StartState]; !exists {
+				http.Error(w, fmt.Sprintf("state %s: map runs unknown state %s", stateDefinition.Name, spec.StartState), http.StatusBadRequest)
+				return
+			}
 		}
-
-		if err := s.db.SaveState(state); err != nil {
-			log.Printf("Error saving state %s: %v", state.Name, err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if subFlow := stateDefinition.SubFlow; subFlow != nil {
+			if _, exists := flow.States[subFlow.StartState]; !exists {
+				http.Error(w, fmt.Sprintf("state %s: sub-flow starts at unknown state %s", stateDefinition.Name, subFlow.StartState), http.StatusBadRequest)
+				return
+			}
 		}
 	}
 
+	// Missing inputs may still come from the run's context, so they are
+	// reported without rejecting the flow
+	warnings := contractWarnings(flow.States, s.chainExecutor.PrimitiveRegistry)
+	for _, warning := range warnings {
+		log.Printf("Flow warning: %s", warning)
+	}
+
+	// Save the states and limits together, removing states left out of the
+	// flow so they don't come back after a restart
+	states := make([]*models.State, 0, len(flow.States))
+	for _, stateDefinition := range flow.States {
+		states = append(states, toModelState(stateDefinition))
+	}
+	var settings *models.FlowSettings
+	if flow.Limits != nil {
+		settings = toModelFlowSettings(*flow.Limits)
+	}
+	if err := s.db.SaveFlow(states, settings); err != nil {
+		log.Printf("Error saving flow: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
 	s.stateDefinitions = flow.States
+	if flow.Limits != nil {
+		s.limits = *flow.Limits
+	}
+	s.mu.Unlock()
 	log.Printf("Saved flow with %d states", len(flow.States))
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]interface{}{
 		"status": "success",
-	})
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 }
 
 func (s *Server) handleGetStates(w http.ResponseWriter, r *http.Request) {
@@ -82,42 +112,7 @@ func (s *Server) handleGetStates(w http.ResponseWriter, r *http.Request) {
 
 	var stateDefinitions []core.StateDefinition
 	for _, state := range states {
-		// Convert PrimitiveChain slice
-		primitiveChains := make([]core.PrimitiveChain, len(state.PreliminaryActions))
-		for i, chain := range state.PreliminaryActions {
-			primitiveChains[i] = core.PrimitiveChain{
-				Primitives:     chain.Primitives,
-				ExecutionOrder: chain.ExecutionOrder,
-			}
-		}
-
-		// Convert Edge slice
-		edges := make([]core.Edge, len(state.Edges))
-		for i, edge := range state.Edges {
-			edges[i] = core.Edge{
-				Source:       edge.Source,
-				Target:       edge.Target,
-				SourceHandle: edge.SourceHandle,
-			}
-		}
-
-		stateDef := core.StateDefinition{
-			Name:               state.Name,
-			PreliminaryActions: primitiveChains,
-			Position: core.Position{
-				X: state.PositionX,
-				Y: state.PositionY,
-			},
-			Edges: edges,
-			Transitions: struct {
-				Success string `json:"success"`
-				Failure string `json:"failure"`
-			}{
-				Success: state.SuccessTransition,
-				Failure: state.FailureTransition,
-			},
-		}
-		stateDefinitions = append(stateDefinitions, stateDef)
+		stateDefinitions = append(stateDefinitions, toStateDefinition(state))
 	}
 
 	log.Printf("Returning states: %v", stateDefinitions)
@@ -134,35 +129,13 @@ func (s *Server) handleSaveState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert to database model
-	modelChains := make([]models.PrimitiveChain, len(stateDefinition.PreliminaryActions))
-	for i, chain := range stateDefinition.PreliminaryActions {
-		modelChains[i] = models.PrimitiveChain{
-			Primitives:     chain.Primitives,
-			ExecutionOrder: chain.ExecutionOrder,
-		}
-	}
-
-	// Convert edges
-	modelEdges := make([]models.Edge, len(stateDefinition.Edges))
-	for i, edge := range stateDefinition.Edges {
-		modelEdges[i] = models.Edge{
-			Source:       edge.Source,
-			Target:       edge.Target,
-			SourceHandle: edge.SourceHandle,
-		}
+	if err := stateDefinition.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	state := &models.State{
-		Name:               stateDefinition.Name,
-		PreliminaryActions: modelChains,
-		MainAction:         stateDefinition.MainAction,
-		PositionX:          stateDefinition.Position.X,
-		PositionY:          stateDefinition.Position.Y,
-		SuccessTransition:  stateDefinition.Transitions.Success,
-		FailureTransition:  stateDefinition.Transitions.Failure,
-		Edges:              modelEdges,
-	}
+	// Convert to database model
+	state := toModelState(stateDefinition)
 
 	if err := s.db.SaveState(state); err != nil {
 		log.Printf("Error saving state: %v", err)
@@ -170,7 +143,9 @@ func (s *Server) handleSaveState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.mu.Lock()
 	s.stateDefinitions[state.Name] = stateDefinition
+	s.mu.Unlock()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": "success",
@@ -189,13 +164,21 @@ func (s *Server) handleDeleteState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.mu.Lock()
 	delete(s.stateDefinitions, stateName)
+	s.mu.Unlock()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "success",
 	})
 }
 
+func (s *Server) handleGetCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET /api/circuit-breakers - Returning circuit breaker states")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.chainExecutor.CircuitBreakers())
+}
+
 func (s *Server) handleGetPrimitives(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GET /api/primitives - Returning available primitives")
 	primitives := []string{
@@ -205,6 +188,8 @@ func (s *Server) handleGetPrimitives(w http.ResponseWriter, r *http.Request) {
 		"allocateInventory",
 		"generateShippingLabel",
 		"shipOrder",
+		"refundPayment",
+		"releaseInventory",
 	}
 	json.NewEncoder(w).Encode(primitives)
 }
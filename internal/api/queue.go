@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+	"github.com/aliatli/reactor/internal/db"
+	"github.com/aliatli/reactor/internal/executor"
+	"github.com/aliatli/reactor/internal/models"
+	"gorm.io/gorm"
+)
+
+// busyRetryDelay is how long a step whose run a request is acting on waits
+// before workers claim it again
+const busyRetryDelay = 200 * time.Millisecond
+
+// ClaimStep leases the next queued run step to owner for lease. It returns
+// nil when no step is ready.
+func (s *Server) ClaimStep(owner string, lease time.Duration) (*models.RunStep, error) {
+	now := time.Now()
+	return s.db.ClaimRunStep(owner, now, now.Add(lease))
+}
+
+// ExecuteStep executes the run of a step claimed with ClaimStep until it
+// finishes or stops, renewing the lease meanwhile, and removes the step from
+// the queue. A step that cannot be executed right now is released to be
+// retried a little later, and one whose run ended already is dropped. A panic
+// while executing fails the run instead of crashing the worker.
+func (s *Server) ExecuteStep(step *models.RunStep, lease time.Duration) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			log.Printf("Run %d panicked: %v\n%s", step.RunID, value, debug.Stack())
+			err = s.failPanickedRun(step, value)
+		}
+	}()
+
+	control := executor.NewRunControl()
+	if !s.trackRun(step.RunID, control) {
+		// A request is acting on the run and may queue it again. Until it
+		// does, the step is held back so workers do not spin on it.
+		return s.db.ReleaseRunStep(step, time.Now().Add(busyRetryDelay))
+	}
+
+	// The run may have been queued again between the claim and the tracking,
+	// taking the lease away
+	current, err := s.db.GetRunStep(step.ID)
+	if err != nil || current.LeaseOwner != step.LeaseOwner {
+		s.untrackRun(step.RunID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	run, err := s.db.GetRun(step.RunID)
+	if err != nil {
+		s.untrackRun(step.RunID)
+		return err
+	}
+	// Running runs were left behind by a worker whose lease expired
+	if run.Status != string(executor.RunStatusQueued) && run.Status != string(executor.RunStatusRunning) {
+		s.untrackRun(run.ID)
+		return s.db.FinishRunStep(step)
+	}
+
+	run.Status = string(executor.RunStatusRunning)
+	if err := s.db.SaveRun(run); err != nil {
+		s.untrackRun(run.ID)
+		return err
+	}
+	if current.Cancel {
+		control.Cancel()
+	}
+
+	// The run is not tied to the worker's lifetime so it is never aborted
+	// halfway; a dead worker's step is picked up again from its checkpoint.
+	// A worker losing its lease pauses the run rather than cancelling it, as
+	// the worker taking the step over carries on from the last checkpoint.
+	owned, lost := context.WithCancel(context.Background())
+	defer lost()
+	err = func() error {
+		defer s.keepLease(step, lease, func() {
+			control.Pause()
+			lost()
+		})()
+		return s.executeRun(owned, run, control, toCheckpoint(*run), executionContext(run))
+	}()
+	if owned.Err() != nil {
+		// The step belongs to another worker now
+		return db.ErrLeaseLost
+	}
+	if err != nil {
+		// The step stays leased and is retried once the lease expires
+		return err
+	}
+	return s.db.FinishRunStep(step)
+}
+
+// failPanickedRun fails the run of a step whose execution panicked and drops
+// the step, so the panic does not repeat on every worker claiming it. The run
+// is not compensated, since the engine state it would compensate from is
+// unreliable.
+func (s *Server) failPanickedRun(step *models.RunStep, value interface{}) error {
+	s.untrackRun(step.RunID)
+	run, err := s.db.GetRun(step.RunID)
+	if err != nil {
+		return err
+	}
+
+	failure := &core.Error{Code: core.CodePanic, Message: fmt.Sprint(value)}
+	run.Status = string(executor.RunStatusFailed)
+	run.Error = failure.Error()
+	run.Failure = toModelFailure(failure)
+	run.WakeAt = nil
+
+	stopped := executor.Event{Type: executor.EventRunStopped, Time: time.Now(), State: run.CurrentState, Status: executor.RunStatusFailed, Error: run.Error, ErrorCode: failure.Code}
+	if err := s.db.CreateRunEvent(toModelRunEvent(run.ID, stopped)); err != nil {
+		log.Printf("Error saving %s event of run %d: %v", stopped.Type, run.ID, err)
+	}
+
+	if run.ParentRunID != nil {
+		err = s.finishChildRun(run)
+	} else {
+		err = s.db.SaveRun(run)
+	}
+	if err != nil {
+		return err
+	}
+	return s.db.FinishRunStep(step)
+}
+
+// keepLease renews the lease of step until the returned function is called.
+// It calls lost once the lease is taken over, or is about to expire because
+// it could not be renewed.
+func (s *Server) keepLease(step *models.RunStep, lease time.Duration, lost func()) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		interval := lease / 3
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				err := s.db.RenewRunStep(step, now.Add(lease))
+				if err == nil {
+					continue
+				}
+				log.Printf("Error renewing lease of run %d: %v", step.RunID, err)
+				// Another try at the next tick would come too late
+				if errors.Is(err, db.ErrLeaseLost) || !now.Add(interval).Before(*step.LeaseExpiresAt) {
+					log.Printf("Lost lease of run %d, stopping it", step.RunID)
+					lost()
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,650 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+	"github.com/aliatli/reactor/internal/db"
+	"github.com/aliatli/reactor/internal/executor"
+	"github.com/aliatli/reactor/internal/models"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// idempotencyWindow is how long a run can be replayed by its idempotency key
+const idempotencyWindow = 24 * time.Hour
+
+func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /api/runs - Starting flow run")
+	var request struct {
+		StartState string                 `json:"startState"`
+		Context    map[string]interface{} `json:"context"`
+		// IdempotencyKey can also be sent in the Idempotency-Key header
+		IdempotencyKey string `json:"idempotencyKey"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding run request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	_, exists := s.stateDefinitions[request.StartState]
+	s.mu.RUnlock()
+	if !exists {
+		http.Error(w, fmt.Sprintf("unknown start state: %q", request.StartState), http.StatusBadRequest)
+		return
+	}
+
+	execCtx := core.NewExecutionContextFrom(request.Context)
+
+	run := &models.Run{
+		StartState:   request.StartState,
+		CurrentState: request.StartState,
+		Status:       string(executor.RunStatusQueued),
+		Context:      execCtx.Snapshot(),
+	}
+
+	key := request.IdempotencyKey
+	if key == "" {
+		key = r.Header.Get("Idempotency-Key")
+	}
+	if key != "" {
+		run.IdempotencyKey = &key
+		existing, created, err := s.db.CreateIdempotentRun(run, time.Now().Add(-idempotencyWindow))
+		if err != nil {
+			log.Printf("Error creating run: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !created {
+			if existing.StartState != request.StartState {
+				http.Error(w, fmt.Sprintf("idempotency key %q was used for a run starting at %s", key, existing.StartState), http.StatusConflict)
+				return
+			}
+			log.Printf("POST /api/runs - Replaying run %d for idempotency key %q", existing.ID, key)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			json.NewEncoder(w).Encode(toRunResponse(*existing))
+			return
+		}
+	} else if err := s.db.CreateRun(run); err != nil {
+		log.Printf("Error creating run: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A worker executes the run; the client follows it with GET /api/runs/{id}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(toRunResponse(*run))
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET /api/runs/%s - Fetching run", mux.Vars(r)["id"])
+
+	run, ok := s.loadRun(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toRunResponse(*run))
+}
+
+// loadRun fetches the run named in the request path, writing the error
+// response when it cannot
+func (s *Server) loadRun(w http.ResponseWriter, r *http.Request) (*models.Run, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	run, err := s.db.GetRun(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error fetching run: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return run, true
+}
+
+func (s *Server) handlePauseRun(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /api/runs/%s/pause - Pausing run", mux.Vars(r)["id"])
+
+	run, ok := s.loadRun(w, r)
+	if !ok {
+		return
+	}
+
+	control, active := s.activeRun(run.ID)
+	if !active {
+		http.Error(w, fmt.Sprintf("run is %s", run.Status), http.StatusConflict)
+		return
+	}
+	control.Pause()
+	if control.Signal() == executor.SignalCancel {
+		http.Error(w, "run is being cancelled", http.StatusConflict)
+		return
+	}
+
+	// The run pauses once its current primitive finishes
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(toRunResponse(*run))
+}
+
+func (s *Server) handleResumeRun(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /api/runs/%s/resume - Resuming run", mux.Vars(r)["id"])
+
+	run, ok := s.loadRun(w, r)
+	if !ok {
+		return
+	}
+
+	// A pause the run has not reached yet is simply withdrawn
+	if control, active := s.activeRun(run.ID); active {
+		if !control.Resume() {
+			http.Error(w, "run is being cancelled", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(toRunResponse(*run))
+		return
+	}
+
+	run, err := s.claimRun(run.ID, executor.RunStatusPaused)
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	response, err := s.queueRun(run, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /api/runs/%s/cancel - Cancelling run", mux.Vars(r)["id"])
+
+	run, ok := s.loadRun(w, r)
+	if !ok {
+		return
+	}
+
+	if control, active := s.activeRun(run.ID); active {
+		// The run is cancelled once its current primitive finishes
+		control.Cancel()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(toRunResponse(*run))
+		return
+	}
+
+	// A paused, waiting or queued run is queued with a cancel pending so it
+	// stops right away and runs its compensations
+	run, err := s.claimRun(run.ID, executor.RunStatusPaused, executor.RunStatusWaiting, executor.RunStatusQueued)
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	response, err := s.queueRun(run, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleSignalRun(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	log.Printf("POST /api/runs/%s/signals/%s - Signalling run", mux.Vars(r)["id"], name)
+
+	run, ok := s.loadRun(w, r)
+	if !ok {
+		return
+	}
+
+	// The payload is optional
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		log.Printf("Error decoding signal payload: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if finished(executor.RunStatus(run.Status)) {
+		http.Error(w, fmt.Sprintf("run is %s", run.Status), http.StatusConflict)
+		return
+	}
+	if !s.waitsForSignal(name) {
+		http.Error(w, fmt.Sprintf("no state waits for signal %s", name), http.StatusBadRequest)
+		return
+	}
+
+	// The signal is stored before looking at the run, so a run that stops to
+	// wait for it meanwhile finds it when it checks for stored signals
+	if err := s.db.CreateRunSignal(&models.RunSignal{RunID: run.ID, Name: name, Payload: payload}); err != nil {
+		log.Printf("Error storing signal %s of run %d: %v", name, run.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := s.deliverSignals(run.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if response == nil {
+		// The run receives the signal once it enters the state waiting for it
+		log.Printf("Stored signal %s for run %d", name, run.ID)
+		stored := toRunResponse(*run)
+		response = &stored
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// waitsForSignal reports whether a state of the flow waits for signal name
+func (s *Server) waitsForSignal(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, state := range s.stateDefinitions {
+		if state.WaitFor != nil && state.WaitFor.Signal == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverSignals queues the run with the given ID if it is waiting for a
+// signal stored for it, so that it receives the signal, and returns the
+// queued run. It returns nil when the run is not waiting for a stored signal.
+func (s *Server) deliverSignals(id uint) (*runResponse, error) {
+	run, err := s.claimRun(id, executor.RunStatusWaiting)
+	if err != nil {
+		var conflict conflictError
+		if errors.As(err, &conflict) {
+			return nil, nil
+		}
+		log.Printf("Error claiming run %d: %v", id, err)
+		return nil, err
+	}
+
+	s.mu.RLock()
+	state := s.stateDefinitions[run.CurrentState]
+	s.mu.RUnlock()
+	if state.WaitFor == nil {
+		s.untrackRun(id)
+		return nil, nil
+	}
+	signal, err := s.db.GetRunSignal(id, state.WaitFor.Signal)
+	if err != nil || signal == nil {
+		s.untrackRun(id)
+		return nil, err
+	}
+
+	response, err := s.queueRun(run, false)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (s *Server) handleGetRunEvents(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET /api/runs/%s/events - Fetching run events", mux.Vars(r)["id"])
+
+	run, ok := s.loadRun(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := s.db.GetRunEvents(run.ID)
+	if err != nil {
+		log.Printf("Error fetching events of run %d: %v", run.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]runEventResponse, len(events))
+	for i, event := range events {
+		response[i] = toRunEventResponse(event)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleGetRuns(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	log.Printf("GET /api/runs - Fetching runs (status=%q)", status)
+
+	runs, err := s.db.GetRuns(status)
+	if err != nil {
+		log.Printf("Error fetching runs: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]runResponse, len(runs))
+	for i, run := range runs {
+		response[i] = toRunResponse(run)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// executeRun runs a stored run from checkpoint under control, persisting a
+// checkpoint each time the run enters a state and the result once it ends or
+// stops. The run must have been registered with trackRun. Once ctx is done
+// the caller no longer owns the run: nothing more is saved, and the caller is
+// expected to have paused the run.
+func (s *Server) executeRun(ctx context.Context, run *models.Run, control *executor.RunControl, checkpoint *executor.Checkpoint, execCtx *core.ExecutionContext) error {
+	runner := s.newRunner()
+	// A stored signal the run received is deleted with the checkpoint
+	// recording it
+	var received *models.RunSignal
+	runner.PendingSignal = func(name string) (map[string]interface{}, bool, error) {
+		signal, err := s.db.GetRunSignal(run.ID, name)
+		if err != nil || signal == nil {
+			return nil, false, err
+		}
+		received = signal
+		return signal.Payload, true, nil
+	}
+	runner.OnCheckpoint = func(checkpoint *executor.Checkpoint) error {
+		if ctx.Err() != nil {
+			return db.ErrLeaseLost
+		}
+		run.WakeAt = wakeAt(checkpoint)
+		run.ReceivedSignal = checkpoint.ReceivedSignal
+		run.ChildResult = toModelChildResult(checkpoint.Child)
+		run.CurrentState = checkpoint.State
+		run.Path = checkpoint.Path
+		run.Context = checkpoint.Data
+		run.Attempts = toModelAttempts(checkpoint.Attempts)
+		run.CompletedSteps = toModelCompletedSteps(checkpoint.CompletedSteps)
+		run.LastError = checkpoint.LastError
+		run.LastFailure = toModelFailure(checkpoint.LastFailure)
+		if err := s.db.SaveCheckpoint(run, received); err != nil {
+			return err
+		}
+		received = nil
+		return nil
+	}
+	var eventsMu sync.Mutex
+	runner.OnEvent = func(event executor.Event) {
+		// Concurrent chains emit events at the same time; storing them one by
+		// one keeps their IDs in the order they were emitted
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.db.CreateRunEvent(toModelRunEvent(run.ID, event)); err != nil {
+			log.Printf("Error saving %s event of run %d: %v", event.Type, run.ID, err)
+		}
+	}
+
+	// Cancelling ctx would fail the run and compensate it, so the runner does
+	// not see it; the caller pauses the run instead
+	result := runner.Resume(executor.WithControl(context.WithoutCancel(ctx), control), checkpoint, execCtx)
+	if ctx.Err() != nil {
+		s.untrackRun(run.ID)
+		log.Printf("Run %d stopped at state %s after its lease was lost", run.ID, result.FinalState)
+		return db.ErrLeaseLost
+	}
+
+	run.Status = string(result.Status)
+	run.Attempts = toModelAttempts(result.Attempts)
+	run.Compensations = toModelCompensations(result.Compensations)
+	if resumeFrom := result.Checkpoint; resumeFrom != nil {
+		run.CurrentState = resumeFrom.State
+		run.Path = resumeFrom.Path
+		run.Context = resumeFrom.Data
+		run.CompletedSteps = toModelCompletedSteps(resumeFrom.CompletedSteps)
+		run.LastError = resumeFrom.LastError
+		run.LastFailure = toModelFailure(resumeFrom.LastFailure)
+		run.WakeAt = wakeAt(resumeFrom)
+		run.ReceivedSignal = resumeFrom.ReceivedSignal
+		run.ChildResult = toModelChildResult(resumeFrom.Child)
+	} else {
+		run.CurrentState = result.FinalState
+		run.Path = result.Path
+		run.Context = execCtx.Snapshot()
+		run.CompletedSteps = nil
+		run.LastError = ""
+		run.LastFailure = nil
+		run.WakeAt = nil
+		run.ReceivedSignal = ""
+		run.ChildResult = nil
+	}
+	if result.Error != nil {
+		run.Error = result.Error.Error()
+	}
+	run.Failure = toModelFailure(core.AsError(result.Error))
+
+	var err error
+	switch {
+	case result.StartChild != nil:
+		err = s.startChildRun(run, result.StartChild)
+	case run.ParentRunID != nil && finished(result.Status):
+		err = s.finishChildRun(run)
+	default:
+		err = s.db.SaveRun(run)
+	}
+	// Control requests arriving from here on see the stored status. Until
+	// then they find the run still executing.
+	s.untrackRun(run.ID)
+	if err != nil {
+		log.Printf("Error saving run %d: %v", run.ID, err)
+		return err
+	}
+	log.Printf("Run %d finished with status %s at state %s", run.ID, run.Status, run.CurrentState)
+
+	// A signal sent while the run was still executing is delivered now
+	if result.Status == executor.RunStatusWaiting {
+		if _, err := s.deliverSignals(run.ID); err != nil {
+			log.Printf("Error delivering signals to run %d: %v", run.ID, err)
+		}
+	}
+	return nil
+}
+
+// finished reports whether a run with status has ended for good
+func finished(status executor.RunStatus) bool {
+	switch status {
+	case executor.RunStatusCompleted, executor.RunStatusFailed, executor.RunStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// startChildRun saves parent as waiting together with the child run its
+// sub-flow state starts, queueing the child
+func (s *Server) startChildRun(parent *models.Run, start *executor.ChildStart) error {
+	child := &models.Run{
+		StartState:   start.StartState,
+		CurrentState: start.StartState,
+		Status:       string(executor.RunStatusQueued),
+		Context:      start.Input,
+	}
+	if err := s.db.CreateChildRun(parent, child); err != nil {
+		return err
+	}
+
+	log.Printf("Run %d started child run %d at state %s", parent.ID, child.ID, child.StartState)
+	return nil
+}
+
+// finishChildRun saves a finished child run and hands its result to the
+// parent waiting for it, queueing the parent. The child's result is dropped
+// when the parent no longer waits for it, e.g. after being cancelled.
+func (s *Server) finishChildRun(child *models.Run) error {
+	// The worker that started the child holds the parent until it has saved
+	// it, and requests may hold it briefly too
+	parent, err := s.claimRun(*child.ParentRunID, executor.RunStatusWaiting)
+	for deadline := time.Now().Add(parentClaimTimeout); err == errRunExecuting && time.Now().Before(deadline); {
+		time.Sleep(parentClaimInterval)
+		parent, err = s.claimRun(*child.ParentRunID, executor.RunStatusWaiting)
+	}
+	if err == nil && (parent.ChildResult != nil || len(parent.ChildRunIDs) == 0 || parent.ChildRunIDs[len(parent.ChildRunIDs)-1] != child.ID) {
+		s.untrackRun(parent.ID)
+		err = conflictError("run is not waiting for this child")
+	}
+	if err != nil {
+		log.Printf("Not resuming parent run %d of run %d: %v", *child.ParentRunID, child.ID, err)
+		return s.db.SaveRun(child)
+	}
+
+	parent.ChildResult = &models.ChildResult{
+		Status: child.Status,
+		Data:   child.Context,
+		Error:  child.Error,
+	}
+	_, err = s.queueRun(parent, false, child)
+	return err
+}
+
+func wakeAt(checkpoint *executor.Checkpoint) *time.Time {
+	if checkpoint.WakeAt.IsZero() {
+		return nil
+	}
+	wakeAt := checkpoint.WakeAt
+	return &wakeAt
+}
+
+// conflictError explains why a run cannot take a request in its current status
+type conflictError string
+
+func (e conflictError) Error() string {
+	return string(e)
+}
+
+const errRunExecuting = conflictError("run is already executing")
+
+// How long and how often a finished child run tries to claim its parent
+const (
+	parentClaimTimeout  = 5 * time.Second
+	parentClaimInterval = 10 * time.Millisecond
+)
+
+// claimRun registers a stored run that is not executing as active and
+// reloads it, so the caller acts on its latest status. It fails with a
+// conflictError when the run is executing or has none of the given statuses.
+// Callers release the claim with queueRun or untrackRun.
+func (s *Server) claimRun(id uint, statuses ...executor.RunStatus) (*models.Run, error) {
+	if !s.trackRun(id, executor.NewRunControl()) {
+		return nil, errRunExecuting
+	}
+
+	run, err := s.db.GetRun(id)
+	if err != nil {
+		s.untrackRun(id)
+		return nil, err
+	}
+	for _, status := range statuses {
+		if run.Status == string(status) {
+			return run, nil
+		}
+	}
+	s.untrackRun(id)
+	return nil, conflictError(fmt.Sprintf("run is %s", run.Status))
+}
+
+func writeClaimError(w http.ResponseWriter, err error) {
+	var conflict conflictError
+	if errors.As(err, &conflict) {
+		http.Error(w, conflict.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("Error claiming run: %v", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// queueRun marks a claimed run as queued for a worker and releases the claim.
+// Runs passed in others are saved in the same transaction. With cancel set,
+// the run starts with a cancel pending.
+func (s *Server) queueRun(run *models.Run, cancel bool, others ...*models.Run) (runResponse, error) {
+	run.Status = string(executor.RunStatusQueued)
+	err := s.db.QueueRun(run, cancel, others...)
+	s.untrackRun(run.ID)
+	if err != nil {
+		log.Printf("Error queueing run %d: %v", run.ID, err)
+		return runResponse{}, err
+	}
+	return toRunResponse(*run), nil
+}
+
+// ResumeRuns queues every run that was still running when the server stopped
+// without a step in the queue, such as runs started before runs were queued.
+// Each one restarts at the state it had entered last. Runs with a step are
+// picked up again once the lease of their dead worker expires. Paused runs
+// stay paused until resumed through the API.
+func (s *Server) ResumeRuns() error {
+	runs, err := s.db.GetRuns(string(executor.RunStatusRunning))
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		if err := s.db.EnsureRunStep(run.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WakeRuns queues the waiting runs whose timer fired by now
+func (s *Server) WakeRuns(now time.Time) error {
+	runs, err := s.db.GetDueRuns(now)
+	if err != nil {
+		return err
+	}
+
+	for _, due := range runs {
+		// The run may have been cancelled since it was fetched
+		run, err := s.claimRun(due.ID, executor.RunStatusWaiting)
+		if err != nil {
+			log.Printf("Skipping wakeup of run %d: %v", due.ID, err)
+			continue
+		}
+		log.Printf("Waking run %d at state %s", run.ID, run.CurrentState)
+		if _, err := s.queueRun(run, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executionContext rebuilds the execution context stored in a run
+func executionContext(run *models.Run) *core.ExecutionContext {
+	return core.NewExecutionContextFrom(run.Context)
+}
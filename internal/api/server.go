@@ -2,26 +2,53 @@ package api
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/aliatli/reactor/internal/core"
 	"github.com/aliatli/reactor/internal/db"
+	"github.com/aliatli/reactor/internal/executor"
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
 	router           *mux.Router
+	mu               sync.RWMutex
 	stateDefinitions map[string]core.StateDefinition
+	limits           core.FlowLimits
+	chainExecutor    *executor.PrimitiveChainExecutor
 	db               *db.Database
+
+	// activeRuns holds the controls of runs executing in this process, and
+	// of runs claimed by a request that is about to queue them
+	runsMu     sync.Mutex
+	activeRuns map[uint]*executor.RunControl
 }
 
-func NewServer(database *db.Database) *Server {
+func NewServer(database *db.Database, chainExecutor *executor.PrimitiveChainExecutor) (*Server, error) {
 	s := &Server{
 		router:           mux.NewRouter(),
 		stateDefinitions: make(map[string]core.StateDefinition),
+		chainExecutor:    chainExecutor,
 		db:               database,
+		activeRuns:       make(map[uint]*executor.RunControl),
+	}
+
+	// Load stored states so runs can execute right after a restart
+	states, err := database.GetAllStates()
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range states {
+		s.stateDefinitions[state.Name] = toStateDefinition(state)
+	}
+	settings, err := database.GetFlowSettings()
+	if err != nil {
+		return nil, err
 	}
+	s.limits = toFlowLimits(settings)
+
 	s.routes()
-	return s
+	return s, nil
 }
 
 func (s *Server) routes() {
@@ -30,7 +57,7 @@ func (s *Server) routes() {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -45,9 +72,63 @@ func (s *Server) routes() {
 	s.router.HandleFunc("/api/states", s.handleSaveState).Methods("POST", "OPTIONS")
 	s.router.HandleFunc("/api/primitives", s.handleGetPrimitives).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/flow", s.handleSaveFlow).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/api/circuit-breakers", s.handleGetCircuitBreakers).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/states/{name}", s.handleDeleteState).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/api/runs", s.handleGetRuns).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/api/runs", s.handleCreateRun).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/api/runs/{id:[0-9]+}", s.handleGetRun).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/api/runs/{id:[0-9]+}/events", s.handleGetRunEvents).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/api/runs/{id:[0-9]+}/pause", s.handlePauseRun).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/api/runs/{id:[0-9]+}/resume", s.handleResumeRun).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/api/runs/{id:[0-9]+}/cancel", s.handleCancelRun).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/api/runs/{id:[0-9]+}/signals/{name}", s.handleSignalRun).Methods("POST", "OPTIONS")
 }
 
 func (s *Server) Router() *mux.Router {
 	return s.router
 }
+
+// newRunner returns a flow runner over a snapshot of the current state
+// definitions, so edits made while a run is in progress do not affect it
+func (s *Server) newRunner() *executor.FlowRunner {
+	s.mu.RLock()
+	definitions := make(map[string]core.StateDefinition, len(s.stateDefinitions))
+	for name, definition := range s.stateDefinitions {
+		definitions[name] = definition
+	}
+	limits := s.limits
+	s.mu.RUnlock()
+
+	runner := executor.NewFlowRunner(&executor.StateExecutor{
+		StateDefinitions: definitions,
+		ChainExecutor:    s.chainExecutor,
+	})
+	runner.Limits = limits
+	return runner
+}
+
+// trackRun registers the control of a run about to execute. It reports false
+// when the run is already executing.
+func (s *Server) trackRun(id uint, control *executor.RunControl) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	if _, active := s.activeRuns[id]; active {
+		return false
+	}
+	s.activeRuns[id] = control
+	return true
+}
+
+func (s *Server) untrackRun(id uint) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	delete(s.activeRuns, id)
+}
+
+// activeRun returns the control of a run executing in this process
+func (s *Server) activeRun(id uint) (*executor.RunControl, bool) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	control, active := s.activeRuns[id]
+	return control, active
+}
@@ -1,13 +1,115 @@
 package core
 
-// ExecutionContext holds the shared state during execution
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrKeyNotFound is returned by Get when the context has no value for a key
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyTypeError is returned by Get when a key holds a value of another type
+type KeyTypeError struct {
+	Key  string
+	Want reflect.Type
+	Got  reflect.Type
+}
+
+func (e *KeyTypeError) Error() string {
+	return fmt.Sprintf("context key %q holds %v, not %v", e.Key, e.Got, e.Want)
+}
+
+// ExecutionContext holds the shared state during execution. It is safe for
+// concurrent use. Values are shared, not copied, so a value read from the
+// context must not be modified in place; Set a new value instead.
 type ExecutionContext struct {
-	Data map[string]interface{}
+	mu   sync.RWMutex
+	data map[string]interface{}
 }
 
 // NewExecutionContext creates a new execution context
 func NewExecutionContext() *ExecutionContext {
 	return &ExecutionContext{
-		Data: make(map[string]interface{}),
+		data: make(map[string]interface{}),
+	}
+}
+
+// NewExecutionContextFrom creates an execution context holding a copy of data
+func NewExecutionContextFrom(data map[string]interface{}) *ExecutionContext {
+	c := NewExecutionContext()
+	c.Merge(data)
+	return c
+}
+
+// Lookup returns the value stored under key
+func (c *ExecutionContext) Lookup(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists := c.data[key]
+	return value, exists
+}
+
+// Set stores value under key
+func (c *ExecutionContext) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+// Merge stores every entry of data
+func (c *ExecutionContext) Merge(data map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range data {
+		c.data[k] = v
+	}
+}
+
+// Snapshot returns a copy of the data. Nested values are shared.
+func (c *ExecutionContext) Snapshot() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snapshot := make(map[string]interface{}, len(c.data))
+	for k, v := range c.data {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// Clone returns a context with a copy of the data, so writes to either
+// context do not show up in the other. Nested values are shared.
+func (c *ExecutionContext) Clone() *ExecutionContext {
+	return &ExecutionContext{data: c.Snapshot()}
+}
+
+// Get returns the value stored under key as a T. Values of another type
+// with the same JSON shape are converted, so data restored from the database,
+// where maps come back as map[string]interface{} and numbers as float64,
+// reads the same as data written by primitives. The converted value is a copy.
+func Get[T any](c *ExecutionContext, key string) (T, error) {
+	var zero T
+	value, exists := c.Lookup(key)
+	if !exists {
+		return zero, fmt.Errorf("context key %q: %w", key, ErrKeyNotFound)
+	}
+	if typed, ok := value.(T); ok {
+		return typed, nil
+	}
+
+	typeErr := &KeyTypeError{Key: key, Want: reflect.TypeOf(&zero).Elem(), Got: reflect.TypeOf(value)}
+	if value == nil {
+		return zero, typeErr
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return zero, typeErr
+	}
+	var converted T
+	if err := json.Unmarshal(encoded, &converted); err != nil {
+		return zero, typeErr
 	}
+	return converted, nil
 }
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ValueType is the JSON-like type of a context value named in a contract
+type ValueType string
+
+const (
+	TypeAny    ValueType = "any"
+	TypeString ValueType = "string"
+	TypeNumber ValueType = "number"
+	TypeBool   ValueType = "bool"
+	TypeObject ValueType = "object"
+	TypeList   ValueType = "list"
+)
+
+// Matches reports whether value has the type. Any Go map or struct is an
+// object and any slice or array a list, so values read back from the
+// database match as well as the ones primitives wrote.
+func (t ValueType) Matches(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	switch t {
+	case TypeString:
+		return v.Kind() == reflect.String
+	case TypeNumber:
+		return v.CanInt() || v.CanUint() || v.CanFloat()
+	case TypeBool:
+		return v.Kind() == reflect.Bool
+	case TypeObject:
+		return v.Kind() == reflect.Map || v.Kind() == reflect.Struct
+	case TypeList:
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	}
+	return true
+}
+
+// Field is a context key read or written by a primitive
+type Field struct {
+	Key  string    `json:"key"`
+	Type ValueType `json:"type"`
+	// Optional fields may be missing; when present they must have Type
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Contract declares the context keys a primitive reads and the keys it writes
+// when it succeeds
+type Contract struct {
+	Inputs  []Field `json:"inputs,omitempty"`
+	Outputs []Field `json:"outputs,omitempty"`
+}
+
+// ContractedPrimitive is a primitive declaring its contract. The chain
+// executor checks its inputs before calling Execute and its outputs after a
+// successful call. Primitives without a contract are not checked.
+type ContractedPrimitive interface {
+	Primitive
+	Contract() Contract
+}
+
+// ContractError reports a primitive input or output that is missing or has
+// the wrong type. It is never retried.
+type ContractError struct {
+	Primitive string
+	// Direction is "input" or "output"
+	Direction string
+	Field     Field
+	// Got is the type of the value found, nil when the key is missing
+	Got reflect.Type
+}
+
+func (e *ContractError) Error() string {
+	if e.Got == nil {
+		return fmt.Sprintf("primitive %s: missing %s %q", e.Primitive, e.Direction, e.Field.Key)
+	}
+	return fmt.Sprintf("primitive %s: %s %q holds %v, not %s", e.Primitive, e.Direction, e.Field.Key, e.Got, e.Field.Type)
+}
+
+func (e *ContractError) ErrorCode() string {
+	return CodeContractViolation
+}
+
+func (e *ContractError) Retryable() bool {
+	return false
+}
+
+// CheckInputs verifies the context holds the contract's inputs
+func (c Contract) CheckInputs(primitive string, execCtx *ExecutionContext) error {
+	for _, field := range c.Inputs {
+		value, _ := execCtx.Lookup(field.Key)
+		if err := checkField(primitive, "input", field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckOutputs verifies data, written by a successful call, holds the
+// contract's outputs
+func (c Contract) CheckOutputs(primitive string, data map[string]interface{}) error {
+	for _, field := range c.Outputs {
+		if err := checkField(primitive, "output", field, data[field.Key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkField(primitive, direction string, field Field, value interface{}) error {
+	if value == nil {
+		if field.Optional {
+			return nil
+		}
+		return &ContractError{Primitive: primitive, Direction: direction, Field: field}
+	}
+	if !field.Type.Matches(value) {
+		return &ContractError{Primitive: primitive, Direction: direction, Field: field, Got: reflect.TypeOf(value)}
+	}
+	return nil
+}
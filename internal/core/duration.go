@@ -0,0 +1,43 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that is written to JSON as a string like "30s"
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts duration strings such as "1m30s" as well as plain
+// numbers, which are read as nanoseconds like time.Duration itself
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(v)
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package core
+
+import "errors"
+
+// Codes of errors raised by the engine itself
+const (
+	CodeTimeout           = "TIMEOUT"
+	CodeContractViolation = "CONTRACT_VIOLATION"
+	CodeLoopLimitExceeded = "LOOP_LIMIT_EXCEEDED"
+	CodePanic             = "PANIC"
+)
+
+// Error is a failure with a machine readable code, such as
+// "PAYMENT_DECLINED". Primitives return it as their error, or set it on an
+// unsuccessful result, and states route its code with ErrorTransitions.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+	// Transient marks failures that retrying may fix. It overrides the
+	// classification of the retry policy.
+	Transient bool                   `json:"transient"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+func (e *Error) Retryable() bool {
+	return e.Transient
+}
+
+// CodedError is an error carrying an error code
+type CodedError interface {
+	error
+	ErrorCode() string
+}
+
+// ErrorCode returns the code of the first coded error in err's chain, or an
+// empty string
+func ErrorCode(err error) string {
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	return ""
+}
+
+// AsError returns the first coded error in err's chain as an *Error, or nil
+func AsError(err error) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	var coded CodedError
+	if !errors.As(err, &coded) {
+		return nil
+	}
+	converted := &Error{Code: coded.ErrorCode(), Message: coded.Error()}
+	var retryable RetryableError
+	if errors.As(err, &retryable) {
+		converted.Transient = retryable.Retryable()
+	}
+	return converted
+}
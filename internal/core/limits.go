@@ -0,0 +1,24 @@
+package core
+
+import "errors"
+
+// FlowLimits bound how long a run can keep moving between states, so a flow
+// whose transitions form a cycle cannot spin forever
+type FlowLimits struct {
+	// MaxVisits caps how often a run may enter any one state. States can set
+	// a cap of their own with StateDefinition.MaxVisits. Zero means no cap.
+	MaxVisits int `json:"maxVisits,omitempty"`
+	// MaxTransitions caps the transitions a run takes in total. Zero means the
+	// runner's default budget.
+	MaxTransitions int `json:"maxTransitions,omitempty"`
+}
+
+func (l *FlowLimits) Validate() error {
+	if l.MaxVisits < 0 {
+		return errors.New("maxVisits must not be negative")
+	}
+	if l.MaxTransitions < 0 {
+		return errors.New("maxTransitions must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aliatli/reactor/internal/expr"
+)
+
+// Map runs a primitive chain, or a flow, once per element of a list in the
+// context data. It runs after the state's preliminary actions and before its
+// main action. Each element runs on its own copy of the context with the
+// element stored under ItemKey; writes to that copy are not merged back.
+// Instead ResultKey receives one entry per element, in list order:
+//
+//	{"success": true, "data": {...}, "error": "..."}
+//
+// where data holds what the chain or flow wrote to the element's context.
+type Map struct {
+	// Items is an expression yielding the list, e.g. "order.items"
+	Items string `json:"items"`
+	// ItemKey defaults to "item"
+	ItemKey string `json:"itemKey,omitempty"`
+	// Exactly one of Chain and StartState is set. A flow started at
+	// StartState runs inline and cannot wait for timers, signals or sub-flows.
+	Chain      *PrimitiveChain `json:"chain,omitempty"`
+	StartState string          `json:"startState,omitempty"`
+	// MaxConcurrency bounds the elements processed at once, 1 when unset
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+	// ToleratedFailures is how many elements may fail before the state fails
+	ToleratedFailures int `json:"toleratedFailures,omitempty"`
+	// ResultKey defaults to "results"
+	ResultKey string `json:"resultKey,omitempty"`
+}
+
+func (m *Map) Validate() error {
+	if _, err := expr.Compile(m.Items); err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	if (m.Chain == nil) == (m.StartState == "") {
+		return errors.New("exactly one of chain and startState must be set")
+	}
+	if m.MaxConcurrency < 0 {
+		return errors.New("maxConcurrency must not be negative")
+	}
+	if m.ToleratedFailures < 0 {
+		return errors.New("toleratedFailures must not be negative")
+	}
+	if m.Chain != nil {
+		return m.Chain.Validate()
+	}
+	return nil
+}
+
+// ItemKeyOrDefault returns the key each element is stored under
+func (m *Map) ItemKeyOrDefault() string {
+	if m.ItemKey == "" {
+		return "item"
+	}
+	return m.ItemKey
+}
+
+// ResultKeyOrDefault returns the key the results are stored under
+func (m *Map) ResultKeyOrDefault() string {
+	if m.ResultKey == "" {
+		return "results"
+	}
+	return m.ResultKey
+}
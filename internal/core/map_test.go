@@ -0,0 +1,39 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapValidateChecksChainOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options PrimitiveOptions
+		want    string
+	}{
+		{"input", PrimitiveOptions{DataMapping: &DataMapping{Input: map[string]string{"amount": "order.("}}}, "primitive reserve data mapping: input amount"},
+		{"output", PrimitiveOptions{DataMapping: &DataMapping{OutputPath: "$.a..b"}}, "primitive reserve data mapping: output path"},
+		{"retry", PrimitiveOptions{Retry: &RetryPolicy{MaxAttempts: -1}}, "primitive reserve retry"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &Map{
+				Items: "items",
+				Chain: &PrimitiveChain{
+					Primitives: []string{"reserve"},
+					Options:    map[string]PrimitiveOptions{"reserve": test.options},
+				},
+			}
+			err := m.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+
+			state := StateDefinition{Name: "Reserve", Map: m}
+			if err := state.Validate(); err == nil || !strings.Contains(err.Error(), "state Reserve map: "+test.want) {
+				t.Errorf("got state error %v, want one containing the map's", err)
+			}
+		})
+	}
+}
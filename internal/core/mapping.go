@@ -0,0 +1,107 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aliatli/reactor/internal/expr"
+)
+
+// DataMapping selects what a primitive reads from the context and where the
+// data it writes goes, so primitives do not have to share one flat namespace
+type DataMapping struct {
+	// Input maps keys of the context the primitive sees to expressions over
+	// the run's context data, e.g. {"amount": "$.order.amount"}. When set, the
+	// primitive sees only these keys.
+	Input map[string]string `json:"input,omitempty"`
+	// OutputPath places the data the primitive writes under a path of the
+	// run's context, e.g. "$.payment" writes it to payment.*, next to what is
+	// already there. When empty the data is written at the top level.
+	OutputPath string `json:"outputPath,omitempty"`
+}
+
+func (m *DataMapping) Validate() error {
+	for key, source := range m.Input {
+		if _, err := expr.Compile(source); err != nil {
+			return fmt.Errorf("input %s: %w", key, err)
+		}
+	}
+	if _, err := m.OutputSegments(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// OutputSegments splits OutputPath into its keys. "$.payment.result" and
+// "payment.result" both give [payment result]; "" and "$" give none.
+func (m *DataMapping) OutputSegments() ([]string, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(m.OutputPath, "$"), ".")
+	if path == "" {
+		return nil, nil
+	}
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("output path %q has an empty key", m.OutputPath)
+		}
+		if strings.ContainsAny(segment, "[]$ ") {
+			return nil, errors.New("output path must be a dotted path of keys, such as $.payment")
+		}
+	}
+	return segments, nil
+}
+
+// Select returns the context a primitive reads from: execCtx itself, or a new
+// context holding the mapped inputs
+func (m *DataMapping) Select(execCtx *ExecutionContext) (*ExecutionContext, error) {
+	if m == nil || m.Input == nil {
+		return execCtx, nil
+	}
+	data, err := MapData(m.Input, execCtx.Snapshot())
+	if err != nil {
+		return nil, fmt.Errorf("input mapping: %w", err)
+	}
+	return NewExecutionContextFrom(data), nil
+}
+
+// Place writes data to execCtx under OutputPath and returns the top-level
+// entries it changed
+func (m *DataMapping) Place(execCtx *ExecutionContext, data map[string]interface{}) (map[string]interface{}, error) {
+	var segments []string
+	if m != nil {
+		var err error
+		if segments, err = m.OutputSegments(); err != nil {
+			return nil, err
+		}
+	}
+	if len(segments) == 0 {
+		execCtx.Merge(data)
+		return data, nil
+	}
+
+	execCtx.mu.Lock()
+	defer execCtx.mu.Unlock()
+	top := mergeAt(execCtx.data[segments[0]], segments[1:], data)
+	execCtx.data[segments[0]] = top
+	return map[string]interface{}{segments[0]: top}, nil
+}
+
+// mergeAt returns a copy of current with data merged in at path. Maps along
+// the path are copied rather than modified, since other contexts may share
+// them; values that are not objects are replaced.
+func mergeAt(current interface{}, path []string, data map[string]interface{}) map[string]interface{} {
+	existing, _ := current.(map[string]interface{})
+	merged := make(map[string]interface{}, len(existing)+len(data))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	if len(path) == 0 {
+		for k, v := range data {
+			merged[k] = v
+		}
+		return merged
+	}
+	merged[path[0]] = mergeAt(existing[path[0]], path[1:], data)
+	return merged
+}
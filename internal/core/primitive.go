@@ -1,13 +1,31 @@
 package core
 
-// PrimitiveResult represents the result of a primitive operation
+import "context"
+
+// PrimitiveResult represents the result of a primitive operation. Setting
+// Outcome or NextState ends the current state early: Outcome follows the
+// state's transition for that outcome, while NextState routes the run
+// directly and must be one of the state's AllowedNextStates. An unsuccessful
+// result can set Error to say why it failed.
 type PrimitiveResult struct {
 	Success   bool
+	Outcome   string
 	NextState string
 	Data      map[string]interface{}
+	Error     *Error
+}
+
+// Routes reports whether the result picks where the run goes next
+func (r *PrimitiveResult) Routes() bool {
+	return r.Outcome != "" || r.NextState != ""
 }
 
-// Primitive defines the interface for all primitive operations
+// Primitive defines the interface for all primitive operations. The context
+// is cancelled when the run is cancelled or the primitive's timeout expires.
+//
+// Primitives run at least once: a run resumed after a crash executes its
+// current state again from the start, so primitives with side effects should
+// be idempotent.
 type Primitive interface {
-	Execute(context *ExecutionContext) (*PrimitiveResult, error)
+	Execute(ctx context.Context, execCtx *ExecutionContext) (*PrimitiveResult, error)
 }
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Failure classes a RetryPolicy can retry on
+const (
+	RetryOnError   = "error"   // a Go error returned by the primitive
+	RetryOnTimeout = "timeout" // the primitive or state ran past its timeout
+	RetryOnFailure = "failure" // a result with Success set to false
+)
+
+// DefaultMaxInterval caps the delay between retries of policies without a
+// MaxInterval
+const DefaultMaxInterval = time.Hour
+
+// RetryPolicy describes how often and how fast a failed primitive or state is retried
+type RetryPolicy struct {
+	// MaxAttempts counts the first execution too; 0 or 1 disables retries
+	MaxAttempts     int      `json:"maxAttempts"`
+	InitialInterval Duration `json:"initialInterval,omitempty"`
+	// MaxInterval caps the delay between retries, DefaultMaxInterval when unset
+	MaxInterval        Duration `json:"maxInterval,omitempty"`
+	BackoffCoefficient float64  `json:"backoffCoefficient,omitempty"`
+	// Jitter randomizes each delay by up to this fraction of it, between 0 and 1
+	Jitter float64 `json:"jitter,omitempty"`
+	// RetryOn lists the failure classes to retry, "error" and "timeout" when empty
+	RetryOn []string `json:"retryOn,omitempty"`
+}
+
+// RetryableError lets an error returned by a primitive decide whether retrying can help
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return errors.New("maxAttempts must not be negative")
+	}
+	if p.InitialInterval < 0 || p.MaxInterval < 0 {
+		return errors.New("intervals must not be negative")
+	}
+	if p.BackoffCoefficient != 0 && p.BackoffCoefficient < 1 {
+		return errors.New("backoffCoefficient must be at least 1")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1")
+	}
+	for _, class := range p.RetryOn {
+		switch class {
+		case RetryOnError, RetryOnTimeout, RetryOnFailure:
+		default:
+			return fmt.Errorf("unknown retryOn class: %q", class)
+		}
+	}
+	return nil
+}
+
+// RetriesOn reports whether failures of the given class are retried
+func (p *RetryPolicy) RetriesOn(class string) bool {
+	if len(p.RetryOn) == 0 {
+		return class == RetryOnError || class == RetryOnTimeout
+	}
+	for _, c := range p.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the given retry, counting from 1. The
+// delay grows exponentially from InitialInterval, is capped at MaxInterval,
+// or DefaultMaxInterval, and then randomized by Jitter.
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	coefficient := p.BackoffCoefficient
+	if coefficient == 0 {
+		coefficient = 2
+	}
+
+	maxInterval := p.MaxInterval.Duration()
+	if maxInterval == 0 {
+		maxInterval = DefaultMaxInterval
+	}
+	// Large retry counts overflow to +Inf, which the cap takes care of
+	delay := math.Min(float64(p.InitialInterval)*math.Pow(coefficient, float64(retry-1)), float64(maxInterval))
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
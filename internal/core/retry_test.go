@@ -0,0 +1,40 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		want   time.Duration
+	}{
+		{"first", RetryPolicy{InitialInterval: Duration(time.Second)}, 1, time.Second},
+		{"doubles", RetryPolicy{InitialInterval: Duration(time.Second)}, 4, 8 * time.Second},
+		{"coefficient", RetryPolicy{InitialInterval: Duration(time.Second), BackoffCoefficient: 3}, 3, 9 * time.Second},
+		{"capped", RetryPolicy{InitialInterval: Duration(time.Second), MaxInterval: Duration(5 * time.Second)}, 10, 5 * time.Second},
+		{"default cap", RetryPolicy{InitialInterval: Duration(time.Second)}, 60, DefaultMaxInterval},
+		{"overflow", RetryPolicy{InitialInterval: Duration(time.Second)}, 5000, DefaultMaxInterval},
+		{"no interval", RetryPolicy{}, 3, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Backoff(test.retry); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitterStaysBounded(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: Duration(time.Second), Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(100); got < DefaultMaxInterval/2 || got > DefaultMaxInterval*3/2 {
+			t.Fatalf("got %s, want within half of %s", got, DefaultMaxInterval)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package core
+
+import "errors"
+
+// OutcomeTimeout is taken by a state whose signal did not arrive in time
+const OutcomeTimeout = "timeout"
+
+// WaitForSignal parks a run in a state until an external signal with the
+// given name is sent to it, such as a payment webhook. The signal's payload
+// is merged into the context data before the state's actions run.
+type WaitForSignal struct {
+	Signal string `json:"signal"`
+	// Timeout, when set, ends the wait with the "timeout" outcome, or with the
+	// failure transition if the state does not declare one
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+func (w *WaitForSignal) Validate() error {
+	if w.Signal == "" {
+		return errors.New("signal name must not be empty")
+	}
+	if w.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	return nil
+}
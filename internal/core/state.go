@@ -1,25 +1,234 @@
 package core
 
+import (
+	"fmt"
+
+	"github.com/aliatli/reactor/internal/expr"
+)
+
 // NextState represents the name of the next state
 type NextState string
 
+// NoTransition is the placeholder the editor stores for an unconnected transition
+const NoTransition = "none"
+
+// TerminalKind marks a state as an end of the flow and tells how runs reaching it finish
+type TerminalKind string
+
+const (
+	// TerminalNone is the zero value for regular, non-terminal states
+	TerminalNone TerminalKind = ""
+	// TerminalSuccess ends the run as completed
+	TerminalSuccess TerminalKind = "success"
+	// TerminalFailure ends the run as failed
+	TerminalFailure TerminalKind = "failure"
+)
+
+// Built-in outcomes every state can take
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Transitions maps the name of an outcome, such as "success", "failure" or
+// "approved", to the state the run moves to when the state ends with it.
+// ErrorTransitions similarly maps error codes, such as "PAYMENT_DECLINED", to
+// the state a run failing with that code moves to instead of the failure
+// transition.
+type Transitions map[string]string
+
+// Merge policies for data written by chains that share an ExecutionOrder
+const (
+	// MergeLastWriteWins keeps the value of the chain declared last
+	MergeLastWriteWins = "lastWriteWins"
+	// MergeFail fails the state when chains write different values to a key
+	MergeFail = "fail"
+)
+
 // StateDefinition defines the structure of a state
 type StateDefinition struct {
-	Name               string           `json:"name"`
-	PreliminaryActions []PrimitiveChain `json:"preliminaryActions"`
-	MainAction         string           `json:"mainAction,omitempty"`
-	Position           Position         `json:"position"`
-	Edges              []Edge           `json:"edges,omitempty"`
-	Transitions        struct {
-		Success string `json:"success"`
-		Failure string `json:"failure"`
-	} `json:"transitions"`
-}
-
-// PrimitiveChain represents a chain of primitive operations
+	Name               string            `json:"name"`
+	PreliminaryActions []PrimitiveChain  `json:"preliminaryActions"`
+	MainAction         string            `json:"mainAction,omitempty"`
+	MainActionOptions  *PrimitiveOptions `json:"mainActionOptions,omitempty"`
+	Timeout            Duration          `json:"timeout,omitempty"`
+	Retry              *RetryPolicy      `json:"retry,omitempty"`
+	Timer              *Timer            `json:"timer,omitempty"`
+	WaitFor            *WaitForSignal    `json:"waitFor,omitempty"`
+	SubFlow            *SubFlow          `json:"subFlow,omitempty"`
+	Map                *Map              `json:"map,omitempty"`
+	DataMapping        *DataMapping      `json:"dataMapping,omitempty"`
+	MergeConflicts     string            `json:"mergeConflicts,omitempty"`
+	MaxVisits          int               `json:"maxVisits,omitempty"`
+	AllowedNextStates  []string          `json:"allowedNextStates,omitempty"`
+	Position           Position          `json:"position"`
+	Edges              []Edge            `json:"edges,omitempty"`
+	Terminal           TerminalKind      `json:"terminal,omitempty"`
+	Transitions        Transitions       `json:"transitions"`
+	ErrorTransitions   map[string]string `json:"errorTransitions,omitempty"`
+	Guards             []Guard           `json:"guards,omitempty"`
+}
+
+// Guard is a transition taken when its expression over the context data holds,
+// e.g. "order.amount > 1000". Guards are checked in order after the state
+// succeeds; the first matching one wins and the success transition is the
+// fallback when none match.
+type Guard struct {
+	Expression string `json:"expression"`
+	Target     string `json:"target"`
+}
+
+// IsTerminal reports whether reaching the state ends the run
+func (s StateDefinition) IsTerminal() bool {
+	return s.Terminal != TerminalNone
+}
+
+// AllowsNextState reports whether a primitive may route the run from this state to name
+func (s StateDefinition) AllowsNextState(name string) bool {
+	for _, allowed := range s.AllowedNextStates {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the state's configuration for values that cannot be executed
+func (s StateDefinition) Validate() error {
+	for outcome := range s.Transitions {
+		if outcome == "" {
+			return fmt.Errorf("state %s: outcome names must not be empty", s.Name)
+		}
+	}
+	for code := range s.ErrorTransitions {
+		if code == "" {
+			return fmt.Errorf("state %s: error codes must not be empty", s.Name)
+		}
+	}
+	for i, guard := range s.Guards {
+		if guard.Target == "" {
+			return fmt.Errorf("state %s: guard %d has no target", s.Name, i+1)
+		}
+		if _, err := expr.Compile(guard.Expression); err != nil {
+			return fmt.Errorf("state %s: guard %q: %w", s.Name, guard.Expression, err)
+		}
+	}
+	if s.MaxVisits < 0 {
+		return fmt.Errorf("state %s: maxVisits must not be negative", s.Name)
+	}
+	switch s.MergeConflicts {
+	case "", MergeLastWriteWins, MergeFail:
+	default:
+		return fmt.Errorf("state %s: unknown mergeConflicts policy %q", s.Name, s.MergeConflicts)
+	}
+	if s.Retry != nil {
+		if err := s.Retry.Validate(); err != nil {
+			return fmt.Errorf("state %s retry: %w", s.Name, err)
+		}
+	}
+	if s.Timer != nil {
+		if err := s.Timer.Validate(); err != nil {
+			return fmt.Errorf("state %s timer: %w", s.Name, err)
+		}
+	}
+	if s.WaitFor != nil {
+		if s.Timer != nil {
+			return fmt.Errorf("state %s: a state cannot have both a timer and a signal to wait for", s.Name)
+		}
+		if err := s.WaitFor.Validate(); err != nil {
+			return fmt.Errorf("state %s waitFor: %w", s.Name, err)
+		}
+	}
+	if s.SubFlow != nil {
+		if s.Timer != nil || s.WaitFor != nil {
+			return fmt.Errorf("state %s: a sub-flow state cannot also have a timer or a signal to wait for", s.Name)
+		}
+		if err := s.SubFlow.Validate(); err != nil {
+			return fmt.Errorf("state %s subFlow: %w", s.Name, err)
+		}
+	}
+	if s.Map != nil {
+		if err := s.Map.Validate(); err != nil {
+			return fmt.Errorf("state %s map: %w", s.Name, err)
+		}
+	}
+	if s.MainActionOptions != nil && s.MainActionOptions.Retry != nil {
+		if err := s.MainActionOptions.Retry.Validate(); err != nil {
+			return fmt.Errorf("state %s main action retry: %w", s.Name, err)
+		}
+	}
+	if s.DataMapping != nil {
+		if err := s.DataMapping.Validate(); err != nil {
+			return fmt.Errorf("state %s data mapping: %w", s.Name, err)
+		}
+	}
+	if s.MainActionOptions != nil && s.MainActionOptions.DataMapping != nil {
+		if err := s.MainActionOptions.DataMapping.Validate(); err != nil {
+			return fmt.Errorf("state %s main action data mapping: %w", s.Name, err)
+		}
+	}
+	for _, chain := range s.PreliminaryActions {
+		if err := chain.Validate(); err != nil {
+			return fmt.Errorf("state %s %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// MappedChain returns chain with the state's data mapping set on every
+// primitive that has none of its own
+func (s StateDefinition) MappedChain(chain PrimitiveChain) PrimitiveChain {
+	if s.DataMapping == nil {
+		return chain
+	}
+	options := make(map[string]PrimitiveOptions, len(chain.Primitives))
+	for name, option := range chain.Options {
+		options[name] = option
+	}
+	for _, name := range chain.Primitives {
+		option := options[name]
+		if option.DataMapping == nil {
+			option.DataMapping = s.DataMapping
+			options[name] = option
+		}
+	}
+	chain.Options = options
+	return chain
+}
+
+// PrimitiveChain represents a chain of primitive operations. Chains run in
+// ascending ExecutionOrder and chains sharing an order run concurrently.
 type PrimitiveChain struct {
-	Primitives     []string
-	ExecutionOrder int
+	Primitives     []string                    `json:"primitives"`
+	ExecutionOrder int                         `json:"executionOrder"`
+	Options        map[string]PrimitiveOptions `json:"options,omitempty"`
+}
+
+// Validate checks the retry policies and data mappings of the chain's primitives
+func (c PrimitiveChain) Validate() error {
+	for name, options := range c.Options {
+		if options.Retry != nil {
+			if err := options.Retry.Validate(); err != nil {
+				return fmt.Errorf("primitive %s retry: %w", name, err)
+			}
+		}
+		if options.DataMapping != nil {
+			if err := options.DataMapping.Validate(); err != nil {
+				return fmt.Errorf("primitive %s data mapping: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// PrimitiveOptions configures a single use of a primitive
+type PrimitiveOptions struct {
+	Timeout Duration     `json:"timeout,omitempty"`
+	Retry   *RetryPolicy `json:"retry,omitempty"`
+	// Compensation names a primitive that undoes this one if the run fails later
+	Compensation string `json:"compensation,omitempty"`
+	// DataMapping overrides the state's data mapping for this primitive
+	DataMapping *DataMapping `json:"dataMapping,omitempty"`
 }
 
 type Position struct {
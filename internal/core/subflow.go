@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aliatli/reactor/internal/expr"
+)
+
+// SubFlow starts another flow as a child run and waits for it to finish
+// before the state's own actions run. The state fails when the child run
+// does not complete.
+type SubFlow struct {
+	StartState string `json:"startState"`
+	// Input maps keys of the child's context data to expressions over the
+	// parent's, e.g. {"amount": "order.amount"}
+	Input map[string]string `json:"input,omitempty"`
+	// Output maps keys of the parent's context data to expressions over the
+	// child's final context data, e.g. {"refundID": "refund.id"}
+	Output map[string]string `json:"output,omitempty"`
+}
+
+func (f *SubFlow) Validate() error {
+	if f.StartState == "" {
+		return errors.New("startState must not be empty")
+	}
+	for key, source := range f.Input {
+		if _, err := expr.Compile(source); err != nil {
+			return fmt.Errorf("input %s: %w", key, err)
+		}
+	}
+	for key, source := range f.Output {
+		if _, err := expr.Compile(source); err != nil {
+			return fmt.Errorf("output %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// MapData builds data from mapping, evaluating each expression against
+// source. Expressions over paths that do not exist are left out.
+func MapData(mapping map[string]string, source map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(mapping))
+	for key, sourceExpr := range mapping {
+		expression, err := expr.Compile(sourceExpr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		value, err := expression.Eval(source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if value != nil {
+			data[key] = value
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aliatli/reactor/internal/cron"
+	"github.com/aliatli/reactor/internal/expr"
+)
+
+// Timer makes a state wait before running its actions. Exactly one of its
+// fields is set. The wakeup is stored with the run, so waiting does not hold
+// any resources and survives restarts.
+type Timer struct {
+	// Delay waits a fixed duration after the state is entered
+	Delay Duration `json:"delay,omitempty"`
+	// Until is a path into the context data, such as "order.deliverBy",
+	// holding the time to wake up at as an RFC 3339 string
+	Until string `json:"until,omitempty"`
+	// Cron wakes up at the next time matching a five-field cron expression,
+	// e.g. "0 9 * * 1-5"
+	Cron string `json:"cron,omitempty"`
+}
+
+func (t *Timer) Validate() error {
+	set := 0
+	if t.Delay != 0 {
+		set++
+	}
+	if t.Until != "" {
+		set++
+	}
+	if t.Cron != "" {
+		set++
+	}
+	if set != 1 {
+		return errors.New("exactly one of delay, until and cron must be set")
+	}
+
+	if t.Delay < 0 {
+		return errors.New("delay must not be negative")
+	}
+	if t.Until != "" {
+		if _, err := expr.Compile(t.Until); err != nil {
+			return fmt.Errorf("until: %w", err)
+		}
+	}
+	if t.Cron != "" {
+		if _, err := cron.Parse(t.Cron); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WakeAt returns when a state entered at now with the given context data
+// wakes up
+func (t *Timer) WakeAt(now time.Time, data map[string]interface{}) (time.Time, error) {
+	switch {
+	case t.Until != "":
+		return wakeUntil(t.Until, data)
+	case t.Cron != "":
+		schedule, err := cron.Parse(t.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		next := schedule.Next(now)
+		if next.IsZero() {
+			return time.Time{}, fmt.Errorf("cron expression %q never matches", t.Cron)
+		}
+		return next, nil
+	}
+	return now.Add(t.Delay.Duration()), nil
+}
+
+func wakeUntil(path string, data map[string]interface{}) (time.Time, error) {
+	expression, err := expr.Compile(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("until: %w", err)
+	}
+	value, err := expression.Eval(data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("until: %w", err)
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		wakeAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("until: %s: %w", path, err)
+		}
+		return wakeAt, nil
+	case nil:
+		return time.Time{}, fmt.Errorf("until: %s is not set", path)
+	}
+	return time.Time{}, fmt.Errorf("until: %s holds %v, not a time", path, value)
+}
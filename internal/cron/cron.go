@@ -0,0 +1,156 @@
+// Package cron parses five-field cron expressions used by timer states:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields accept *, single values, ranges (1-5), lists (1,15) and steps
+// (*/15, 9-17/2). Day-of-week runs from 0 (Sunday) to 6, with 7 also
+// meaning Sunday. As in classic cron, when both day fields are restricted a
+// time matches if either of them does.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow bits
+	// domAny and dowAny record unrestricted day fields
+	domAny, dowAny bool
+}
+
+type bits uint64
+
+func (b bits) has(n int) bool {
+	return b&(1<<uint(n)) != 0
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a five-field cron expression
+func Parse(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields, got %d", spec, len(fields), len(parts))
+	}
+
+	values := make([]bits, len(fields))
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", spec, err)
+		}
+		values[i] = b
+	}
+
+	// Sunday can be written as 0 or 7
+	dow := values[4]
+	if dow.has(7) {
+		dow |= 1
+	}
+
+	return &Schedule{
+		minute: values[0],
+		hour:   values[1],
+		dom:    values[2],
+		month:  values[3],
+		dow:    dow,
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func parseField(text string, f field) (bits, error) {
+	var result bits
+	for _, item := range strings.Split(text, ",") {
+		rangeText, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rangeText = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, item)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rangeText != "*" {
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %s field %q", f.name, item)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %s field %q", f.name, item)
+				}
+			} else if step > 1 {
+				// "5/15" means every 15 starting at 5
+				high = f.max
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%s field %q is out of range %d-%d", f.name, item, f.min, f.max)
+		}
+
+		for n := low; n <= high; n += step {
+			result |= 1 << uint(n)
+		}
+	}
+	return result, nil
+}
+
+// Next returns the first time after t matching the schedule, in t's
+// location. It returns the zero time when nothing matches within five years,
+// as with "0 0 30 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case !s.month.has(int(month)):
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+		case !s.hour.has(t.Hour()):
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,85 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, time.January, 3, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 3, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 3, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 3, 10, 25, 0, 0, time.UTC)},
+		{"0 9-17/2 * * *", time.Date(2024, 1, 3, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 1, 4, 9, 0, 0, 0, time.UTC)},
+		{"30 8 1,15 * *", time.Date(2024, 1, 15, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 3 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Sunday as 0 and as 7
+		{"0 12 * * 0", time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches
+		{"0 0 20 * 5", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// Never matches
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			schedule, err := Parse(test.spec)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := schedule.Next(from); !got.Equal(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	schedule, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2024, 1, 3, 10, 0, 0, 0, loc))
+	if want := time.Date(2024, 1, 4, 9, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"* * * *", "must have 5 fields"},
+		{"60 * * * *", "out of range"},
+		{"* 24 * * *", "out of range"},
+		{"* * 0 * *", "out of range"},
+		{"* * * 13 *", "out of range"},
+		{"* * * * 8", "out of range"},
+		{"5-1 * * * *", "out of range"},
+		{"*/0 * * * *", "invalid step"},
+		{"a * * * *", "invalid minute field"},
+		{"1-b * * * *", "invalid minute field"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			_, err := Parse(test.spec)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/aliatli/reactor/internal/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -11,34 +15,84 @@ type Database struct {
 }
 
 func NewDatabase() (*Database, error) {
-	db, err := gorm.Open(sqlite.Open("reactor.db"), &gorm.Config{})
+	return Open("reactor.db")
+}
+
+// Open opens and migrates the SQLite database at path
+func Open(path string) (*Database, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
 
 	// Auto migrate the schema
-	err = db.AutoMigrate(&models.State{})
+	err = db.AutoMigrate(&models.State{}, &models.Run{}, &models.RunStep{}, &models.RunSignal{}, &models.RunEvent{}, &models.FlowSettings{})
 	if err != nil {
 		return nil, err
 	}
 
+	if err := migrateTransitions(db); err != nil {
+		return nil, err
+	}
+
 	return &Database{db}, nil
 }
 
 func (db *Database) SaveState(state *models.State) error {
+	return saveState(db.DB, state)
+}
+
+func saveState(tx *gorm.DB, state *models.State) error {
 	// First try to find the state, including soft deleted ones
 	var existingState models.State
-	result := db.Unscoped().Where("name = ?", state.Name).First(&existingState)
+	result := tx.Unscoped().Where("name = ?", state.Name).First(&existingState)
 
 	if result.Error == nil {
 		// If found (even if deleted), hard delete it first
-		if err := db.Unscoped().Where("name = ?", state.Name).Delete(&models.State{}).Error; err != nil {
+		if err := tx.Unscoped().Where("name = ?", state.Name).Delete(&models.State{}).Error; err != nil {
 			return err
 		}
 	}
 
 	// Create new state
-	return db.Create(state).Error
+	return tx.Create(state).Error
+}
+
+// SaveFlow replaces the stored states with states in a single transaction,
+// deleting the ones left out. Settings are saved too unless nil.
+func (db *Database) SaveFlow(states []*models.State, settings *models.FlowSettings) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var stored []string
+		if err := tx.Unscoped().Model(&models.State{}).Pluck("name", &stored).Error; err != nil {
+			return err
+		}
+		kept := make(map[string]bool, len(states))
+		for _, state := range states {
+			kept[state.Name] = true
+		}
+		var removed []string
+		for _, name := range stored {
+			if !kept[name] {
+				removed = append(removed, name)
+			}
+		}
+		if len(removed) > 0 {
+			if err := tx.Unscoped().Where("name IN ?", removed).Delete(&models.State{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, state := range states {
+			if err := saveState(tx, state); err != nil {
+				return fmt.Errorf("saving state %s: %w", state.Name, err)
+			}
+		}
+
+		if settings == nil {
+			return nil
+		}
+		return saveFlowSettings(tx, settings)
+	})
 }
 
 func (db *Database) GetAllStates() ([]models.State, error) {
@@ -51,3 +105,283 @@ func (db *Database) DeleteState(name string) error {
 	// Hard delete the state
 	return db.Unscoped().Where("name = ?", name).Delete(&models.State{}).Error
 }
+
+// GetFlowSettings returns the stored flow settings, or empty settings when
+// none were saved yet
+func (db *Database) GetFlowSettings() (*models.FlowSettings, error) {
+	return getFlowSettings(db.DB)
+}
+
+func getFlowSettings(tx *gorm.DB) (*models.FlowSettings, error) {
+	var settings models.FlowSettings
+	err := tx.Limit(1).Find(&settings).Error
+	return &settings, err
+}
+
+// SaveFlowSettings stores settings, replacing the ones saved before
+func (db *Database) SaveFlowSettings(settings *models.FlowSettings) error {
+	return saveFlowSettings(db.DB, settings)
+}
+
+func saveFlowSettings(tx *gorm.DB, settings *models.FlowSettings) error {
+	existing, err := getFlowSettings(tx)
+	if err != nil {
+		return err
+	}
+	settings.ID = existing.ID
+	return tx.Save(settings).Error
+}
+
+// CreateRun creates run and queues it for a worker
+func (db *Database) CreateRun(run *models.Run) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return createQueuedRun(tx, run)
+	})
+}
+
+func createQueuedRun(tx *gorm.DB, run *models.Run) error {
+	if err := tx.Create(run).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.RunStep{RunID: run.ID}).Error
+}
+
+// CreateIdempotentRun creates and queues run unless a run with the same idempotency key
+// was created after since, in which case it returns that run and false. The
+// key of an older run is released so run can take it over.
+func (db *Database) CreateIdempotentRun(run *models.Run, since time.Time) (*models.Run, bool, error) {
+	var existing *models.Run
+	err := db.Transaction(func(tx *gorm.DB) error {
+		found, err := findRunByKey(tx, *run.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+		if found != nil {
+			if found.CreatedAt.After(since) {
+				existing = found
+				return nil
+			}
+			if err := tx.Exec("UPDATE runs SET idempotency_key = NULL WHERE id = ?", found.ID).Error; err != nil {
+				return err
+			}
+		}
+		return createQueuedRun(tx, run)
+	})
+	if existing != nil {
+		return existing, false, nil
+	}
+	if err != nil {
+		// A concurrent request with the same key may have won the race
+		if found, findErr := findRunByKey(db.DB, *run.IdempotencyKey); findErr == nil && found != nil && found.CreatedAt.After(since) {
+			return found, false, nil
+		}
+		return nil, false, err
+	}
+	return run, true, nil
+}
+
+func findRunByKey(tx *gorm.DB, key string) (*models.Run, error) {
+	var runs []models.Run
+	if err := tx.Unscoped().Where("idempotency_key = ?", key).Limit(1).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	return &runs[0], nil
+}
+
+func (db *Database) SaveRun(run *models.Run) error {
+	return db.Save(run).Error
+}
+
+// SaveCheckpoint saves run, deleting the stored signal it received, if any,
+// in the same transaction
+func (db *Database) SaveCheckpoint(run *models.Run, received *models.RunSignal) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if received != nil {
+			if err := tx.Delete(received).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(run).Error
+	})
+}
+
+func (db *Database) CreateRunSignal(signal *models.RunSignal) error {
+	return db.Create(signal).Error
+}
+
+// GetRunSignal returns the oldest signal named name stored for a run, or nil
+// when there is none
+func (db *Database) GetRunSignal(runID uint, name string) (*models.RunSignal, error) {
+	var signals []models.RunSignal
+	if err := db.Where("run_id = ? AND name = ?", runID, name).Order("id").Limit(1).Find(&signals).Error; err != nil {
+		return nil, err
+	}
+	if len(signals) == 0 {
+		return nil, nil
+	}
+	return &signals[0], nil
+}
+
+// CreateChildRun creates and queues child and links it to parent, saving
+// parent in the same transaction
+func (db *Database) CreateChildRun(parent, child *models.Run) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		child.ParentRunID = &parent.ID
+		if err := createQueuedRun(tx, child); err != nil {
+			return err
+		}
+		parent.ChildRunIDs = append(parent.ChildRunIDs, child.ID)
+		return tx.Save(parent).Error
+	})
+}
+
+func (db *Database) GetRun(id uint) (*models.Run, error) {
+	var run models.Run
+	if err := db.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (db *Database) CreateRunEvent(event *models.RunEvent) error {
+	return db.Create(event).Error
+}
+
+// GetRunEvents returns the events of a run in the order they happened
+func (db *Database) GetRunEvents(runID uint) ([]models.RunEvent, error) {
+	var events []models.RunEvent
+	err := db.Where("run_id = ?", runID).Order("id").Find(&events).Error
+	return events, err
+}
+
+// GetRuns returns runs newest first, optionally filtered by status
+func (db *Database) GetRuns(status string) ([]models.Run, error) {
+	var runs []models.Run
+	query := db.Order("id desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&runs).Error
+	return runs, err
+}
+
+// GetDueRuns returns waiting runs whose timer fired by now, earliest first
+func (db *Database) GetDueRuns(now time.Time) ([]models.Run, error) {
+	var runs []models.Run
+	err := db.Where("status = ? AND wake_at <= ?", "waiting", now).Order("wake_at").Find(&runs).Error
+	return runs, err
+}
+
+// ErrLeaseLost is returned for a run step whose lease was taken over by
+// another worker or dropped when the run was queued again
+var ErrLeaseLost = errors.New("lease lost")
+
+// QueueRun saves run and queues it for a worker, saving the runs in others in
+// the same transaction. A step already queued for the run is kept, losing its
+// lease, and keeps a pending cancel.
+func (db *Database) QueueRun(run *models.Run, cancel bool, others ...*models.Run) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, other := range others {
+			if err := tx.Save(other).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(run).Error; err != nil {
+			return err
+		}
+
+		var step models.RunStep
+		if err := tx.Where("run_id = ?", run.ID).Limit(1).Find(&step).Error; err != nil {
+			return err
+		}
+		step.RunID = run.ID
+		step.Cancel = step.Cancel || cancel
+		step.LeaseOwner = ""
+		step.LeaseExpiresAt = nil
+		return tx.Save(&step).Error
+	})
+}
+
+// EnsureRunStep queues the run with the given ID unless it has a step already
+func (db *Database) EnsureRunStep(runID uint) error {
+	return db.Where(models.RunStep{RunID: runID}).FirstOrCreate(&models.RunStep{}).Error
+}
+
+// ClaimRunStep leases the oldest step that is not leased, or whose lease
+// expired by now, to owner until expiresAt. It returns nil when no step is
+// ready.
+func (db *Database) ClaimRunStep(owner string, now, expiresAt time.Time) (*models.RunStep, error) {
+	for {
+		var steps []models.RunStep
+		err := db.Where("lease_expires_at IS NULL OR lease_expires_at <= ?", now).Order("id").Limit(1).Find(&steps).Error
+		if err != nil || len(steps) == 0 {
+			return nil, err
+		}
+
+		step := steps[0]
+		result := db.Model(&models.RunStep{}).
+			Where("id = ? AND (lease_expires_at IS NULL OR lease_expires_at <= ?)", step.ID, now).
+			Updates(map[string]interface{}{"lease_owner": owner, "lease_expires_at": expiresAt})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			step.LeaseOwner = owner
+			step.LeaseExpiresAt = &expiresAt
+			return &step, nil
+		}
+		// Another worker claimed the step first
+	}
+}
+
+func (db *Database) GetRunStep(id uint) (*models.RunStep, error) {
+	var step models.RunStep
+	if err := db.First(&step, id).Error; err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+// RenewRunStep extends the lease of a step claimed by step.LeaseOwner
+func (db *Database) RenewRunStep(step *models.RunStep, expiresAt time.Time) error {
+	result := db.Model(&models.RunStep{}).
+		Where("id = ? AND lease_owner = ?", step.ID, step.LeaseOwner).
+		Update("lease_expires_at", expiresAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	step.LeaseExpiresAt = &expiresAt
+	return nil
+}
+
+// ReleaseRunStep gives up the lease of a step so any worker can claim it again
+// from retryAt on. Queueing the run again makes it ready right away.
+func (db *Database) ReleaseRunStep(step *models.RunStep, retryAt time.Time) error {
+	return db.Model(&models.RunStep{}).
+		Where("id = ? AND lease_owner = ?", step.ID, step.LeaseOwner).
+		Updates(map[string]interface{}{"lease_owner": "", "lease_expires_at": retryAt}).Error
+}
+
+// FinishRunStep removes an executed step from the queue, unless the run was
+// queued again in the meantime
+func (db *Database) FinishRunStep(step *models.RunStep) error {
+	return db.Where("id = ? AND lease_owner = ?", step.ID, step.LeaseOwner).Delete(&models.RunStep{}).Error
+}
+
+// GetQueueStats counts the steps ready to be claimed by now and the steps
+// leased to workers
+func (db *Database) GetQueueStats(now time.Time) (ready, leased int64, err error) {
+	// Released steps waiting to be retried count as ready
+	err = db.Model(&models.RunStep{}).Where("lease_owner = '' OR lease_expires_at IS NULL OR lease_expires_at <= ?", now).Count(&ready).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	err = db.Model(&models.RunStep{}).Where("lease_owner <> '' AND lease_expires_at > ?", now).Count(&leased).Error
+	return ready, leased, err
+}
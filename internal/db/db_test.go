@@ -0,0 +1,306 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliatli/reactor/internal/models"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Discard
+	return db
+}
+
+func createRuns(t *testing.T, db *Database, n int) []*models.Run {
+	t.Helper()
+	runs := make([]*models.Run, n)
+	for i := range runs {
+		runs[i] = &models.Run{StartState: "Start", CurrentState: "Start", Status: "queued"}
+		if err := db.CreateRun(runs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return runs
+}
+
+func claim(t *testing.T, db *Database, owner string, now time.Time) *models.RunStep {
+	t.Helper()
+	step, err := db.ClaimRunStep(owner, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return step
+}
+
+func TestClaimRunStep(t *testing.T) {
+	db := openTestDatabase(t)
+	runs := createRuns(t, db, 2)
+	now := time.Now()
+
+	first := claim(t, db, "a", now)
+	second := claim(t, db, "b", now)
+	if first == nil || second == nil || first.RunID != runs[0].ID || second.RunID != runs[1].ID {
+		t.Fatalf("got steps %+v and %+v, want the steps of runs %d and %d in order", first, second, runs[0].ID, runs[1].ID)
+	}
+	if first.LeaseOwner != "a" || first.LeaseExpiresAt == nil {
+		t.Errorf("got lease %q until %v, want it owned by a", first.LeaseOwner, first.LeaseExpiresAt)
+	}
+	if step := claim(t, db, "c", now); step != nil {
+		t.Errorf("claimed leased step %+v", step)
+	}
+
+	ready, leased, err := db.GetQueueStats(now)
+	if err != nil || ready != 0 || leased != 2 {
+		t.Errorf("got %d ready and %d leased (%v), want 0 and 2", ready, leased, err)
+	}
+}
+
+func TestExpiredLeaseIsClaimedAgain(t *testing.T) {
+	db := openTestDatabase(t)
+	createRuns(t, db, 1)
+	now := time.Now()
+
+	dead := claim(t, db, "dead", now)
+	later := now.Add(2 * time.Minute)
+	ready, _, err := db.GetQueueStats(later)
+	if err != nil || ready != 1 {
+		t.Errorf("got %d ready (%v) after the lease expired, want 1", ready, err)
+	}
+
+	taken := claim(t, db, "alive", later)
+	if taken == nil || taken.ID != dead.ID {
+		t.Fatalf("got %+v, want the expired step %d", taken, dead.ID)
+	}
+
+	// The dead worker lost its lease and can no longer touch the step
+	if err := db.RenewRunStep(dead, later.Add(time.Minute)); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("got %v renewing a lost lease, want ErrLeaseLost", err)
+	}
+	if err := db.FinishRunStep(dead); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRunStep(dead.ID); err != nil {
+		t.Errorf("step was removed by the worker that lost its lease: %v", err)
+	}
+
+	if err := db.RenewRunStep(taken, later.Add(time.Minute)); err != nil {
+		t.Errorf("renewing the current lease: %v", err)
+	}
+}
+
+func TestReleaseRunStep(t *testing.T) {
+	db := openTestDatabase(t)
+	createRuns(t, db, 1)
+	now := time.Now()
+
+	step := claim(t, db, "a", now)
+	other := *step
+	other.LeaseOwner = "b"
+	if err := db.ReleaseRunStep(&other, now); err != nil {
+		t.Fatal(err)
+	}
+	if again := claim(t, db, "b", now); again != nil {
+		t.Fatalf("step released by a worker not owning it was claimed again")
+	}
+
+	retryAt := now.Add(time.Second)
+	if err := db.ReleaseRunStep(step, retryAt); err != nil {
+		t.Fatal(err)
+	}
+	if again := claim(t, db, "b", now); again != nil {
+		t.Fatalf("released step claimed again before %v", retryAt)
+	}
+	if ready, leased, err := db.GetQueueStats(now); err != nil || ready != 1 || leased != 0 {
+		t.Errorf("got %d ready and %d leased steps, %v, want the released step ready", ready, leased, err)
+	}
+	again := claim(t, db, "b", retryAt)
+	if again == nil || again.ID != step.ID {
+		t.Fatalf("got %+v, want released step %d", again, step.ID)
+	}
+}
+
+func TestFinishRunStep(t *testing.T) {
+	db := openTestDatabase(t)
+	createRuns(t, db, 1)
+	step := claim(t, db, "a", time.Now())
+
+	if err := db.FinishRunStep(step); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRunStep(step.ID); err == nil {
+		t.Error("finished step is still queued")
+	}
+}
+
+func TestQueueRunTakesLeaseAway(t *testing.T) {
+	db := openTestDatabase(t)
+	runs := createRuns(t, db, 1)
+	now := time.Now()
+	step := claim(t, db, "a", now)
+
+	// A request queues the run again, with a cancel, while a worker holds it
+	if err := db.QueueRun(runs[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishRunStep(step); err != nil {
+		t.Fatal(err)
+	}
+
+	again := claim(t, db, "b", now)
+	if again == nil || again.ID != step.ID || !again.Cancel {
+		t.Fatalf("got %+v, want step %d queued again with a cancel", again, step.ID)
+	}
+	// Queueing once more keeps the pending cancel
+	if err := db.QueueRun(runs[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := db.GetRunStep(step.ID); err != nil || !current.Cancel || current.LeaseOwner != "" {
+		t.Errorf("got %+v (%v), want an unleased step with a cancel", current, err)
+	}
+}
+
+func TestSaveFlowRemovesStatesLeftOut(t *testing.T) {
+	db := openTestDatabase(t)
+	for _, name := range []string{"Start", "Old"} {
+		if err := db.SaveState(&models.State{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteState("Old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveState(&models.State{Name: "Old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	flow := []*models.State{{Name: "Start", MainAction: "charge"}, {Name: "Next"}}
+	if err := db.SaveFlow(flow, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := db.GetAllStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, state := range states {
+		got[state.Name] = state.MainAction
+	}
+	if len(got) != 2 || got["Start"] != "charge" || got["Next"] != "" {
+		t.Errorf("got states %v, want Start and Next only", got)
+	}
+
+	if err := db.SaveFlow(nil, &models.FlowSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	if states, err := db.GetAllStates(); err != nil || len(states) != 0 {
+		t.Errorf("got %d states, %v, want none", len(states), err)
+	}
+}
+
+func TestSaveCheckpointDeletesReceivedSignal(t *testing.T) {
+	db := openTestDatabase(t)
+	run := createRuns(t, db, 1)[0]
+	for _, amount := range []float64{1, 2} {
+		if err := db.CreateRunSignal(&models.RunSignal{RunID: run.ID, Name: "paid", Payload: map[string]interface{}{"amount": amount}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signal, err := db.GetRunSignal(run.ID, "paid")
+	if err != nil || signal == nil || signal.Payload["amount"] != 1.0 {
+		t.Fatalf("got signal %+v, %v, want the oldest one", signal, err)
+	}
+	if other, err := db.GetRunSignal(run.ID, "shipped"); err != nil || other != nil {
+		t.Errorf("got signal %+v, %v, want none", other, err)
+	}
+
+	run.ReceivedSignal = "paid"
+	if err := db.SaveCheckpoint(run, signal); err != nil {
+		t.Fatal(err)
+	}
+	next, err := db.GetRunSignal(run.ID, "paid")
+	if err != nil || next == nil || next.Payload["amount"] != 2.0 {
+		t.Errorf("got signal %+v, %v, want the second one", next, err)
+	}
+	if saved, err := db.GetRun(run.ID); err != nil || saved.ReceivedSignal != "paid" {
+		t.Errorf("got run %+v, %v, want the checkpoint saved", saved, err)
+	}
+}
+
+func TestCreateIdempotentRun(t *testing.T) {
+	tests := []struct {
+		name  string
+		start string
+		// expired creates the first run before the key window
+		expired     bool
+		wantCreated bool
+	}{
+		{"replay", "Start", false, false},
+		{"different payload", "Other", false, false},
+		{"expired key", "Start", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openTestDatabase(t)
+			key := "order-1"
+			newRun := func(start string) *models.Run {
+				return &models.Run{StartState: start, CurrentState: start, Status: "queued", IdempotencyKey: &key}
+			}
+
+			first, created, err := db.CreateIdempotentRun(newRun("Start"), time.Now().Add(-time.Hour))
+			if err != nil || !created {
+				t.Fatalf("got created %v, %v, want the first run created", created, err)
+			}
+			since := first.CreatedAt.Add(-time.Hour)
+			if test.expired {
+				since = first.CreatedAt.Add(time.Second)
+			}
+
+			run, created, err := db.CreateIdempotentRun(newRun(test.start), since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != test.wantCreated {
+				t.Fatalf("got created %v, want %v", created, test.wantCreated)
+			}
+			if !test.wantCreated {
+				if run.ID != first.ID || run.StartState != "Start" {
+					t.Errorf("got run %d starting at %s, want the first run %d", run.ID, run.StartState, first.ID)
+				}
+				if step := claim(t, db, "a", time.Now()); step == nil || step.RunID != first.ID {
+					t.Fatalf("got step %+v, want only the step of run %d", step, first.ID)
+				}
+				if step := claim(t, db, "a", time.Now()); step != nil {
+					t.Errorf("got step %+v of a replayed request", step)
+				}
+				return
+			}
+
+			if run.ID == first.ID {
+				t.Fatalf("got the expired run %d back, want a new one", run.ID)
+			}
+			old, err := db.GetRun(first.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if old.IdempotencyKey != nil {
+				t.Errorf("got key %q on the expired run, want it released", *old.IdempotencyKey)
+			}
+			saved, err := db.GetRun(run.ID)
+			if err != nil || saved.IdempotencyKey == nil || *saved.IdempotencyKey != key {
+				t.Errorf("got run %+v, %v, want it to hold key %q", saved, err, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/aliatli/reactor/internal/models"
+	"gorm.io/gorm"
+)
+
+// migrateTransitions moves states saved with the fixed success/failure
+// transition columns to the outcome keyed transitions column and drops the
+// legacy columns afterwards
+func migrateTransitions(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.State{}, "success_transition") {
+		return nil
+	}
+
+	var legacyStates []struct {
+		ID                uint
+		SuccessTransition string
+		FailureTransition string
+	}
+	err := db.Table("states").
+		Select("id, success_transition, failure_transition").
+		Where("transitions IS NULL OR transitions = ''").
+		Scan(&legacyStates).Error
+	if err != nil {
+		return err
+	}
+
+	for _, legacy := range legacyStates {
+		transitions, err := json.Marshal(map[string]string{
+			"success": legacy.SuccessTransition,
+			"failure": legacy.FailureTransition,
+		})
+		if err != nil {
+			return err
+		}
+		err = db.Table("states").Where("id = ?", legacy.ID).UpdateColumn("transitions", string(transitions)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := migrator.DropColumn(&models.State{}, "success_transition"); err != nil {
+		return err
+	}
+	if err := migrator.DropColumn(&models.State{}, "failure_transition"); err != nil {
+		return err
+	}
+
+	// SQLite drops columns by rebuilding the table, which loses its indexes
+	return db.AutoMigrate(&models.State{})
+}
@@ -0,0 +1,238 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// CodeCircuitOpen is the code of the error returned for calls to a primitive
+// whose circuit is open
+const CodeCircuitOpen = "CIRCUIT_OPEN"
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed lets all calls through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails calls without making them
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a few probe calls through to see if the primitive recovered
+	BreakerHalfOpen BreakerState = "halfOpen"
+)
+
+// BreakerConfig configures the circuit breaker of a primitive
+type BreakerConfig struct {
+	// FailureRate opens the circuit once this share of the calls in Window
+	// failed, e.g. 0.5
+	FailureRate float64 `json:"failureRate"`
+	// MinCalls is how many calls Window must hold before the rate counts
+	MinCalls int `json:"minCalls"`
+	// Window is how far back calls count towards the failure rate
+	Window core.Duration `json:"window"`
+	// OpenDuration is how long the circuit stays open before probing
+	OpenDuration core.Duration `json:"openDuration"`
+	// HalfOpenProbes is how many probe calls must succeed to close the
+	// circuit again; a failing probe opens it
+	HalfOpenProbes int `json:"halfOpenProbes"`
+}
+
+func (c BreakerConfig) Validate() error {
+	if c.FailureRate <= 0 || c.FailureRate > 1 {
+		return errors.New("failureRate must be in (0, 1]")
+	}
+	if c.MinCalls < 1 {
+		return errors.New("minCalls must be at least 1")
+	}
+	if c.Window <= 0 || c.OpenDuration <= 0 {
+		return errors.New("window and openDuration must be positive")
+	}
+	if c.HalfOpenProbes < 1 {
+		return errors.New("halfOpenProbes must be at least 1")
+	}
+	return nil
+}
+
+// BreakerStatus is a snapshot of a circuit breaker
+type BreakerStatus struct {
+	Primitive string        `json:"primitive"`
+	State     BreakerState  `json:"state"`
+	Config    BreakerConfig `json:"config"`
+	// Calls and Failures count the calls in the current window
+	Calls    int        `json:"calls"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// CircuitBreaker stops calls to a failing primitive for a while so runs fail
+// fast instead of waiting on it. A call fails when the primitive returns an
+// error or a result with a transient *core.Error; unsuccessful results are
+// decisions of the primitive and do not count. Calls stopped by the run
+// being cancelled do not count either.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	state    BreakerState
+	calls    []breakerCall
+	openedAt time.Time
+	// probes counts the probe calls let through since the circuit went
+	// half-open, succeeded those that succeeded
+	probes    int
+	succeeded int
+	// now is replaced by tests
+	now func() time.Time
+}
+
+type breakerCall struct {
+	at     time.Time
+	failed bool
+}
+
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{config: config, state: BreakerClosed, now: time.Now}
+}
+
+// allow reports whether a call to primitive may go ahead
+func (b *CircuitBreaker) allow(primitive string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.config.OpenDuration.Duration() {
+		b.state = BreakerHalfOpen
+		b.probes, b.succeeded = 0, 0
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		return b.openError(primitive, b.openedAt.Add(b.config.OpenDuration.Duration()))
+	case BreakerHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes {
+			return b.openError(primitive, time.Time{})
+		}
+		b.probes++
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) openError(primitive string, retryAt time.Time) *core.Error {
+	err := &core.Error{
+		Code:    CodeCircuitOpen,
+		Message: fmt.Sprintf("circuit of primitive %s is %s", primitive, b.state),
+		Details: map[string]interface{}{"primitive": primitive, "state": b.state},
+	}
+	if !retryAt.IsZero() {
+		err.Details["retryAt"] = retryAt
+	}
+	return err
+}
+
+// record counts the outcome of a call allowed by allow
+func (b *CircuitBreaker) record(ctx context.Context, result *core.PrimitiveResult, err error) {
+	if b == nil {
+		return
+	}
+	failed := err != nil
+	if result != nil && !result.Success && result.Error != nil && result.Error.Transient {
+		failed = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if ctx.Err() != nil {
+		// The run was cancelled; give back a probe without judging the primitive
+		b.giveBack()
+		return
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.open(now)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.config.HalfOpenProbes {
+			b.state = BreakerClosed
+			b.calls = nil
+		}
+	case BreakerClosed:
+		b.calls = append(b.prune(now), breakerCall{at: now, failed: failed})
+		calls, failures := b.count()
+		if calls >= b.config.MinCalls && float64(failures) >= b.config.FailureRate*float64(calls) {
+			b.open(now)
+		}
+	}
+}
+
+// cancel gives back a call allowed by allow that was not made
+func (b *CircuitBreaker) cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.giveBack()
+}
+
+func (b *CircuitBreaker) giveBack() {
+	if b.state == BreakerHalfOpen && b.probes > b.succeeded {
+		b.probes--
+	}
+}
+
+func (b *CircuitBreaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.calls = nil
+}
+
+// prune drops calls that fell out of the window
+func (b *CircuitBreaker) prune(now time.Time) []breakerCall {
+	cutoff := now.Add(-b.config.Window.Duration())
+	i := 0
+	for i < len(b.calls) && b.calls[i].at.Before(cutoff) {
+		i++
+	}
+	return b.calls[i:]
+}
+
+func (b *CircuitBreaker) count() (calls, failures int) {
+	for _, call := range b.calls {
+		if call.failed {
+			failures++
+		}
+	}
+	return len(b.calls), failures
+}
+
+// Status returns a snapshot of the breaker of primitive
+func (b *CircuitBreaker) Status(primitive string) BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	now := b.now()
+	if state == BreakerOpen && now.Sub(b.openedAt) >= b.config.OpenDuration.Duration() {
+		// The next call probes
+		state = BreakerHalfOpen
+	}
+	b.calls = b.prune(now)
+	calls, failures := b.count()
+	status := BreakerStatus{Primitive: primitive, State: state, Config: b.config, Calls: calls, Failures: failures}
+	if state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,172 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// fakeClock is a clock tests move forward by hand
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// Outcomes of a call in breaker tests
+const (
+	callOK      = "ok"      // the primitive succeeded
+	callFail    = "fail"    // the primitive returned an error
+	callDecline = "decline" // an unsuccessful result with a permanent error
+	callPending = "pending" // the call was allowed and has not finished yet
+	callCancel  = "cancel"  // the call was allowed but not made
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	config := BreakerConfig{
+		FailureRate:    0.5,
+		MinCalls:       4,
+		Window:         core.Duration(10 * time.Second),
+		OpenDuration:   core.Duration(5 * time.Second),
+		HalfOpenProbes: 2,
+	}
+	type call struct {
+		advance  time.Duration
+		outcome  string
+		rejected bool
+		want     BreakerState
+	}
+	opened := []call{
+		{0, callFail, false, BreakerClosed},
+		{0, callFail, false, BreakerClosed},
+		{0, callFail, false, BreakerClosed},
+		{0, callFail, false, BreakerOpen},
+	}
+
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{"stays closed below min calls", []call{
+			{0, callFail, false, BreakerClosed},
+			{0, callFail, false, BreakerClosed},
+			{0, callFail, false, BreakerClosed},
+		}},
+		{"opens at the failure rate", []call{
+			{0, callOK, false, BreakerClosed},
+			{0, callFail, false, BreakerClosed},
+			{0, callOK, false, BreakerClosed},
+			{0, callFail, false, BreakerOpen},
+			{time.Second, callOK, true, BreakerOpen},
+		}},
+		{"stays closed under the failure rate", []call{
+			{0, callOK, false, BreakerClosed},
+			{0, callOK, false, BreakerClosed},
+			{0, callFail, false, BreakerClosed},
+			{0, callOK, false, BreakerClosed},
+		}},
+		{"declines do not count", []call{
+			{0, callDecline, false, BreakerClosed},
+			{0, callDecline, false, BreakerClosed},
+			{0, callDecline, false, BreakerClosed},
+			{0, callDecline, false, BreakerClosed},
+		}},
+		{"calls fall out of the window", []call{
+			{0, callFail, false, BreakerClosed},
+			{0, callFail, false, BreakerClosed},
+			{0, callFail, false, BreakerClosed},
+			{11 * time.Second, callFail, false, BreakerClosed},
+		}},
+		{"half-opens after the cooldown and closes after the probes", append(append([]call(nil), opened...),
+			call{4 * time.Second, callOK, true, BreakerOpen},
+			call{time.Second, callOK, false, BreakerHalfOpen},
+			call{0, callOK, false, BreakerClosed},
+			call{0, callFail, false, BreakerClosed},
+		)},
+		{"a failing probe opens again", append(append([]call(nil), opened...),
+			call{5 * time.Second, callOK, false, BreakerHalfOpen},
+			call{0, callFail, false, BreakerOpen},
+			call{time.Second, callOK, true, BreakerOpen},
+			call{5 * time.Second, callOK, false, BreakerHalfOpen},
+		)},
+		{"probes are limited", append(append([]call(nil), opened...),
+			call{5 * time.Second, callPending, false, BreakerHalfOpen},
+			call{0, callPending, false, BreakerHalfOpen},
+			call{0, callOK, true, BreakerHalfOpen},
+		)},
+		{"probes not made are given back", append(append([]call(nil), opened...),
+			call{5 * time.Second, callCancel, false, BreakerHalfOpen},
+			call{0, callCancel, false, BreakerHalfOpen},
+			call{0, callOK, false, BreakerHalfOpen},
+			call{0, callOK, false, BreakerClosed},
+		)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock()
+			breaker := NewCircuitBreaker(config)
+			breaker.now = clock.now
+
+			for i, c := range test.calls {
+				clock.advance(c.advance)
+				err := breaker.allow("charge")
+				if rejected := err != nil; rejected != c.rejected {
+					t.Fatalf("call %d: got error %v, want rejected %v", i+1, err, c.rejected)
+				}
+				if err != nil {
+					if code := core.ErrorCode(err); code != CodeCircuitOpen {
+						t.Errorf("call %d: got code %q, want %q", i+1, code, CodeCircuitOpen)
+					}
+				} else {
+					switch c.outcome {
+					case callOK:
+						breaker.record(context.Background(), &core.PrimitiveResult{Success: true}, nil)
+					case callFail:
+						breaker.record(context.Background(), nil, errors.New("unavailable"))
+					case callDecline:
+						breaker.record(context.Background(), &core.PrimitiveResult{Error: core.NewError("DECLINED", "")}, nil)
+					case callCancel:
+						breaker.cancel()
+					}
+				}
+				if state := breaker.Status("charge").State; state != c.want {
+					t.Fatalf("call %d: got state %s, want %s", i+1, state, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresCancelledCalls(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureRate: 1, MinCalls: 1, Window: core.Duration(time.Minute), OpenDuration: core.Duration(time.Minute), HalfOpenProbes: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := breaker.allow("charge"); err != nil {
+		t.Fatal(err)
+	}
+	breaker.record(ctx, nil, ctx.Err())
+	if status := breaker.Status("charge"); status.State != BreakerClosed || status.Calls != 0 {
+		t.Errorf("got %+v, want a closed breaker without calls", status)
+	}
+}
@@ -1,29 +1,129 @@
 package executor
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aliatli/reactor/internal/core"
 )
 
 type PrimitiveChainExecutor struct {
 	PrimitiveRegistry map[string]core.Primitive
+
+	breakersMu sync.RWMutex
+	breakers   map[string]*CircuitBreaker
+
+	limitersMu sync.RWMutex
+	limiters   map[string]*Limiter
 }
 
 func NewPrimitiveChainExecutor() *PrimitiveChainExecutor {
 	return &PrimitiveChainExecutor{
 		PrimitiveRegistry: make(map[string]core.Primitive),
+		breakers:          make(map[string]*CircuitBreaker),
+		limiters:          make(map[string]*Limiter),
+	}
+}
+
+// SetCircuitBreaker puts calls to the named primitive behind a circuit
+// breaker shared by all runs. While the circuit is open, calls fail at once
+// with a *core.Error coded CodeCircuitOpen.
+func (pce *PrimitiveChainExecutor) SetCircuitBreaker(name string, config BreakerConfig) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("circuit breaker of %s: %w", name, err)
+	}
+	pce.breakersMu.Lock()
+	defer pce.breakersMu.Unlock()
+	pce.breakers[name] = NewCircuitBreaker(config)
+	return nil
+}
+
+// CircuitBreakers returns the status of every circuit breaker, sorted by
+// primitive name
+func (pce *PrimitiveChainExecutor) CircuitBreakers() []BreakerStatus {
+	pce.breakersMu.RLock()
+	defer pce.breakersMu.RUnlock()
+	statuses := make([]BreakerStatus, 0, len(pce.breakers))
+	for name, breaker := range pce.breakers {
+		statuses = append(statuses, breaker.Status(name))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Primitive < statuses[j].Primitive
+	})
+	return statuses
+}
+
+func (pce *PrimitiveChainExecutor) breaker(name string) *CircuitBreaker {
+	pce.breakersMu.RLock()
+	defer pce.breakersMu.RUnlock()
+	return pce.breakers[name]
+}
+
+// SetLimit throttles calls to the named primitives with one limiter shared by
+// all runs, so primitives calling the same provider can share its quota.
+// Calls over the limit wait for their turn, or fail with a *core.Error coded
+// CodeRateLimited when config.Reject is set.
+func (pce *PrimitiveChainExecutor) SetLimit(config LimitConfig, names ...string) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("limit of %v: %w", names, err)
+	}
+	limiter := NewLimiter(config)
+	pce.limitersMu.Lock()
+	defer pce.limitersMu.Unlock()
+	for _, name := range names {
+		pce.limiters[name] = limiter
 	}
+	return nil
 }
 
-func (pce *PrimitiveChainExecutor) Execute(chain core.PrimitiveChain, context *core.ExecutionContext) (*core.PrimitiveResult, error) {
+func (pce *PrimitiveChainExecutor) limiter(name string) *Limiter {
+	pce.limitersMu.RLock()
+	defer pce.limitersMu.RUnlock()
+	return pce.limiters[name]
+}
+
+// Execute runs the chain's primitives in order, stopping at the first failure
+// or at the first primitive that chooses an outcome or a next state. On success the result
+// carries all data the chain wrote to the context. A pause or cancel request
+// stops the chain before its next primitive with an *InterruptedError. Primitives
+// implementing core.ContractedPrimitive fail with a *core.ContractError when
+// their inputs are missing from the context or their outputs from the result.
+// A primitive's data mapping selects the context it reads and places the data
+// it writes.
+func (pce *PrimitiveChainExecutor) Execute(ctx context.Context, chain core.PrimitiveChain, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	written := make(map[string]interface{})
 	for _, primitiveName := range chain.Primitives {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := interrupted(ctx); err != nil {
+			return nil, err
+		}
+
 		primitive, exists := pce.PrimitiveRegistry[primitiveName]
 		if !exists {
 			return nil, fmt.Errorf("primitive not found: %s", primitiveName)
 		}
 
-		result, err := primitive.Execute(context)
+		mapping := chain.Options[primitiveName].DataMapping
+		input, err := mapping.Select(execCtx)
+		if err != nil {
+			return nil, fmt.Errorf("primitive %s: %w", primitiveName, err)
+		}
+
+		contracted, hasContract := primitive.(core.ContractedPrimitive)
+		if hasContract {
+			if err := contracted.Contract().CheckInputs(primitiveName, input); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := pce.executeWithRetry(ctx, primitiveName, primitive, chain.Options[primitiveName], input)
 		if err != nil {
 			return nil, err
 		}
@@ -32,11 +132,124 @@ func (pce *PrimitiveChainExecutor) Execute(chain core.PrimitiveChain, context *c
 			return result, nil // Break chain on failure
 		}
 
+		if compensation := chain.Options[primitiveName].Compensation; compensation != "" {
+			recordCompletion(ctx, primitiveName, compensation)
+		}
+
+		// The primitive ran, so it is compensated even if its outputs break the contract
+		if hasContract {
+			if err := contracted.Contract().CheckOutputs(primitiveName, result.Data); err != nil {
+				return nil, err
+			}
+		}
+
 		// Update context with result data
-		for k, v := range result.Data {
-			context.Data[k] = v
+		changed, err := mapping.Place(execCtx, result.Data)
+		if err != nil {
+			return nil, fmt.Errorf("primitive %s: %w", primitiveName, err)
+		}
+		for k, v := range changed {
+			written[k] = v
+		}
+
+		// A primitive choosing an outcome or the next state ends the chain
+		if result.Routes() {
+			return &core.PrimitiveResult{Success: true, Outcome: result.Outcome, NextState: result.NextState, Data: written}, nil
 		}
 	}
 
-	return &core.PrimitiveResult{Success: true}, nil
+	return &core.PrimitiveResult{Success: true, Data: written}, nil
+}
+
+// executeWithRetry executes a primitive, retrying failed attempts according
+// to its retry policy and recording each attempt in the run history. Attempts
+// made while the primitive's circuit is open fail without calling it; the
+// others first wait for the primitive's limits.
+func (pce *PrimitiveChainExecutor) executeWithRetry(ctx context.Context, name string, primitive core.Primitive, options core.PrimitiveOptions, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	breaker := pce.breaker(name)
+	limiter := pce.limiter(name)
+	for attempt := 1; ; attempt++ {
+		startedAt := time.Now()
+		recordEvent(ctx, Event{Type: EventPrimitiveStarted, Primitive: name, Attempt: attempt})
+		var result *core.PrimitiveResult
+		var waited time.Duration
+		err := breaker.allow(name)
+		if err == nil {
+			var release func()
+			waited, release, err = limiter.acquire(ctx, name)
+			if err == nil {
+				result, err = pce.executePrimitive(ctx, name, primitive, options, execCtx)
+				release()
+				breaker.record(ctx, result, err)
+			} else {
+				breaker.cancel()
+			}
+		}
+		recordAttempt(ctx, name, attempt, startedAt, waited, result != nil && result.Success, err)
+		recordEvent(ctx, primitiveFinished(name, attempt, startedAt, waited, result, err))
+
+		if !shouldRetry(ctx, options.Retry, attempt, result, err) {
+			return result, err
+		}
+		if waitErr := waitBackoff(ctx, options.Retry, attempt); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+}
+
+type primitiveOutcome struct {
+	result *core.PrimitiveResult
+	err    error
+}
+
+// executePrimitive runs a single primitive under its configured timeout. The
+// primitive runs on its own goroutine so that one ignoring ctx cannot block
+// the chain; its late result is discarded. A panic in the primitive becomes a
+// *PanicError, and a primitive returning neither a result nor an error fails.
+func (pce *PrimitiveChainExecutor) executePrimitive(ctx context.Context, name string, primitive core.Primitive, options core.PrimitiveOptions, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	primitiveCtx := ctx
+	timeout := options.Timeout.Duration()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		primitiveCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan primitiveOutcome, 1)
+	go func() {
+		defer func() {
+			if value := recover(); value != nil {
+				log.Printf("Primitive %s panicked: %v\n%s", name, value, debug.Stack())
+				done <- primitiveOutcome{err: &PanicError{Primitive: name, Value: value}}
+			}
+		}()
+		result, err := primitive.Execute(primitiveCtx, execCtx)
+		done <- primitiveOutcome{result: result, err: err}
+	}()
+
+	select {
+	case outcome := <-done:
+		if outcome.err != nil && primitiveCtx.Err() != nil {
+			return nil, contextError(ctx, primitiveCtx, "primitive", name, timeout)
+		}
+		if outcome.err == nil && outcome.result == nil {
+			return nil, fmt.Errorf("primitive %s returned no result", name)
+		}
+		return outcome.result, outcome.err
+	case <-primitiveCtx.Done():
+		return nil, contextError(ctx, primitiveCtx, "primitive", name, timeout)
+	}
+}
+
+// contextError explains why scopedCtx ended: errors of the enclosing ctx are
+// passed through so the scope that owns the deadline can report it, while an
+// expired deadline of scopedCtx itself becomes a TimeoutError
+func contextError(ctx, scopedCtx context.Context, scope, name string, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if scopedCtx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Scope: scope, Name: name, Timeout: timeout}
+	}
+	return scopedCtx.Err()
 }
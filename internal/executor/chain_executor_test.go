@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+type primitiveFunc func(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error)
+
+func (f primitiveFunc) Execute(ctx context.Context, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	return f(ctx, execCtx)
+}
+
+func TestExecuteRecoversPanics(t *testing.T) {
+	pce := NewPrimitiveChainExecutor()
+	calls := 0
+	pce.PrimitiveRegistry["boom"] = primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		calls++
+		var m map[string]int
+		m["x"] = 1
+		return nil, nil
+	})
+
+	chain := core.PrimitiveChain{
+		Primitives: []string{"boom"},
+		Options: map[string]core.PrimitiveOptions{
+			"boom": {Retry: &core.RetryPolicy{MaxAttempts: 3}},
+		},
+	}
+	_, err := pce.Execute(context.Background(), chain, core.NewExecutionContext())
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Primitive != "boom" {
+		t.Fatalf("got error %v, want a *PanicError for boom", err)
+	}
+	if code := core.ErrorCode(err); code != core.CodePanic {
+		t.Errorf("got code %q, want %q", code, core.CodePanic)
+	}
+	if calls != 1 {
+		t.Errorf("panicking primitive was called %d times, want 1", calls)
+	}
+}
+
+func TestExecuteRejectsNilResult(t *testing.T) {
+	pce := NewPrimitiveChainExecutor()
+	pce.PrimitiveRegistry["empty"] = primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		return nil, nil
+	})
+
+	_, err := pce.Execute(context.Background(), core.PrimitiveChain{Primitives: []string{"empty"}}, core.NewExecutionContext())
+	if err == nil || !strings.Contains(err.Error(), "returned no result") {
+		t.Fatalf("got error %v, want one about the missing result", err)
+	}
+}
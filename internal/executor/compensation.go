@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// Compensation records the execution of a compensating primitive for a
+// primitive that completed before the run failed
+type Compensation struct {
+	State        string        `json:"state"`
+	Primitive    string        `json:"primitive"`
+	Compensation string        `json:"compensation"`
+	Success      bool          `json:"success"`
+	Error        string        `json:"error,omitempty"`
+	StartedAt    time.Time     `json:"startedAt"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// CompletedStep is a successful primitive execution that declared a compensation
+type CompletedStep struct {
+	State        string `json:"state"`
+	Primitive    string `json:"primitive"`
+	Compensation string `json:"compensation"`
+}
+
+// recordCompletion remembers a completed primitive so it can be compensated
+// if the run carried by ctx fails later on
+func recordCompletion(ctx context.Context, primitive string, compensation string) {
+	history, ok := ctx.Value(historyKey{}).(*runHistory)
+	if !ok {
+		return
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	history.completed = append(history.completed, CompletedStep{
+		State:        history.state,
+		Primitive:    primitive,
+		Compensation: compensation,
+	})
+}
+
+// compensate runs the compensations of completed steps, most recent first.
+// Compensation is best effort: a failing compensation is recorded and the
+// remaining ones still run. Attempts and events of a compensation are
+// recorded under the state of the step it undoes.
+func (fr *FlowRunner) compensate(ctx context.Context, history *runHistory, execCtx *core.ExecutionContext) []Compensation {
+	history.mu.Lock()
+	completed := append([]CompletedStep(nil), history.completed...)
+	stoppedIn := history.state
+	history.mu.Unlock()
+	defer history.enterState(stoppedIn)
+
+	var compensations []Compensation
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		history.enterState(step.State)
+		startedAt := time.Now()
+		result, err := fr.StateExecutor.ChainExecutor.Execute(ctx, core.PrimitiveChain{
+			Primitives: []string{step.Compensation},
+		}, execCtx)
+
+		compensation := Compensation{
+			State:        step.State,
+			Primitive:    step.Primitive,
+			Compensation: step.Compensation,
+			Success:      err == nil && result.Success,
+			StartedAt:    startedAt,
+			Duration:     time.Since(startedAt),
+		}
+		if err != nil {
+			compensation.Error = err.Error()
+		} else if !result.Success {
+			compensation.Error = resultError(result)
+		}
+		if !compensation.Success {
+			log.Printf("Compensation %s for %s in state %s failed: %s", step.Compensation, step.Primitive, step.State, compensation.Error)
+		}
+		compensations = append(compensations, compensation)
+	}
+	return compensations
+}
+
+// resultError describes an unsuccessful result, using its typed error or its
+// "error" data when present
+func resultError(result *core.PrimitiveResult) string {
+	if result.Error != nil {
+		return result.Error.Error()
+	}
+	if message, ok := result.Data["error"].(string); ok {
+		return message
+	}
+	return "primitive reported failure"
+}
@@ -0,0 +1,63 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+func TestCompensationsRecordedUnderTheirState(t *testing.T) {
+	se := NewStateExecutor()
+	succeed := primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		return &core.PrimitiveResult{Success: true}, nil
+	})
+	se.ChainExecutor.PrimitiveRegistry["reserve"] = succeed
+	se.ChainExecutor.PrimitiveRegistry["release"] = succeed
+	se.ChainExecutor.PrimitiveRegistry["charge"] = primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		return &core.PrimitiveResult{Success: false}, nil
+	})
+
+	se.StateDefinitions["Reserve"] = core.StateDefinition{
+		Name: "Reserve",
+		PreliminaryActions: []core.PrimitiveChain{{
+			Primitives:     []string{"reserve"},
+			ExecutionOrder: 1,
+			Options:        map[string]core.PrimitiveOptions{"reserve": {Compensation: "release"}},
+		}},
+		Transitions: core.Transitions{core.OutcomeSuccess: "Charge"},
+	}
+	se.StateDefinitions["Charge"] = core.StateDefinition{
+		Name:        "Charge",
+		MainAction:  "charge",
+		Transitions: core.Transitions{core.OutcomeFailure: "Failed"},
+	}
+	se.StateDefinitions["Failed"] = core.StateDefinition{Name: "Failed", Terminal: core.TerminalFailure}
+
+	fr := NewFlowRunner(se)
+	var events []Event
+	fr.OnEvent = func(event Event) { events = append(events, event) }
+
+	result := fr.Run(context.Background(), "Reserve", core.NewExecutionContext())
+	if result.Status != RunStatusFailed || len(result.Compensations) != 1 {
+		t.Fatalf("got status %s with compensations %+v, want a failed run with one compensation", result.Status, result.Compensations)
+	}
+
+	var found bool
+	for _, attempt := range result.Attempts {
+		if attempt.Primitive == "release" {
+			found = true
+			if attempt.State != "Reserve" {
+				t.Errorf("compensation attempt recorded under state %s, want Reserve", attempt.State)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no attempt recorded for the compensation in %+v", result.Attempts)
+	}
+	for _, event := range events {
+		if event.Primitive == "release" && event.State != "Reserve" {
+			t.Errorf("compensation event %s recorded under state %s, want Reserve", event.Type, event.State)
+		}
+	}
+}
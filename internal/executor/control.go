@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Signal is an operator request to a running flow
+type Signal string
+
+const (
+	SignalNone   Signal = ""
+	SignalPause  Signal = "pause"
+	SignalCancel Signal = "cancel"
+)
+
+// ErrInterrupted is returned when a chain stops between primitives because
+// its run was paused or cancelled
+var ErrInterrupted = errors.New("run interrupted")
+
+// InterruptedError carries the request that interrupted a run. It matches
+// ErrInterrupted with errors.Is.
+type InterruptedError struct {
+	Signal Signal
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInterrupted, e.Signal)
+}
+
+func (e *InterruptedError) Is(target error) bool {
+	return target == ErrInterrupted
+}
+
+// RunControl delivers pause and cancel requests to a run. The runner checks
+// it between states and the chain executor between primitives, so a primitive
+// that already started always finishes.
+type RunControl struct {
+	mu     sync.Mutex
+	signal Signal
+	// stop is closed while a request is pending
+	stop chan struct{}
+}
+
+func NewRunControl() *RunControl {
+	return &RunControl{}
+}
+
+// Pause asks the run to stop at the next check. It has no effect on a run
+// that is being cancelled.
+func (c *RunControl) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.signal == SignalNone {
+		close(c.stopped())
+	}
+	if c.signal != SignalCancel {
+		c.signal = SignalPause
+	}
+}
+
+// Cancel asks the run to stop at the next check and end as cancelled
+func (c *RunControl) Cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.signal == SignalNone {
+		close(c.stopped())
+	}
+	c.signal = SignalCancel
+}
+
+// Resume withdraws a pause the run has not acted on yet. It reports false
+// when the run is being cancelled instead.
+func (c *RunControl) Resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.signal == SignalCancel {
+		return false
+	}
+	if c.signal == SignalPause {
+		c.stop = make(chan struct{})
+	}
+	c.signal = SignalNone
+	return true
+}
+
+// Done returns a channel that is closed once a request is pending
+func (c *RunControl) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopped()
+}
+
+// stopped returns stop, creating it first if needed. c.mu must be held.
+func (c *RunControl) stopped() chan struct{} {
+	if c.stop == nil {
+		c.stop = make(chan struct{})
+	}
+	return c.stop
+}
+
+// Signal returns the pending request, if any
+func (c *RunControl) Signal() Signal {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.signal
+}
+
+type controlKey struct{}
+
+// WithControl attaches control to the run executed with ctx
+func WithControl(ctx context.Context, control *RunControl) context.Context {
+	return context.WithValue(ctx, controlKey{}, control)
+}
+
+// controlSignal returns the signal pending for the run carried by ctx
+func controlSignal(ctx context.Context) Signal {
+	control, ok := ctx.Value(controlKey{}).(*RunControl)
+	if !ok || control == nil {
+		return SignalNone
+	}
+	return control.Signal()
+}
+
+// interrupted returns an *InterruptedError when a pause or cancel is pending
+// for the run carried by ctx
+func interrupted(ctx context.Context) error {
+	if signal := controlSignal(ctx); signal != SignalNone {
+		return &InterruptedError{Signal: signal}
+	}
+	return nil
+}
+
+// controlDone returns a channel closed once a pause or cancel is pending for
+// the run carried by ctx. It is nil for runs without a RunControl.
+func controlDone(ctx context.Context) <-chan struct{} {
+	control, ok := ctx.Value(controlKey{}).(*RunControl)
+	if !ok || control == nil {
+		return nil
+	}
+	return control.Done()
+}
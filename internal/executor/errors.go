@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// TimeoutError reports that a primitive or a whole state ran past its timeout
+type TimeoutError struct {
+	Scope   string // "primitive" or "state"
+	Name    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s %s timed out after %s", e.Scope, e.Name, e.Timeout)
+}
+
+func (e *TimeoutError) ErrorCode() string {
+	return core.CodeTimeout
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// PanicError reports a primitive that panicked. Retrying does not help, so
+// it is never retried.
+type PanicError struct {
+	Primitive string
+	Value     interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("primitive %s panicked: %v", e.Primitive, e.Value)
+}
+
+func (e *PanicError) ErrorCode() string {
+	return core.CodePanic
+}
+
+func (e *PanicError) Retryable() bool {
+	return false
+}
@@ -0,0 +1,127 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// EventType names something that happened during a run
+type EventType string
+
+const (
+	EventRunStarted        EventType = "runStarted"
+	EventRunResumed        EventType = "runResumed"
+	EventStateEntered      EventType = "stateEntered"
+	EventPrimitiveStarted  EventType = "primitiveStarted"
+	EventPrimitiveFinished EventType = "primitiveFinished"
+	EventStateFinished     EventType = "stateFinished"
+	EventTransition        EventType = "transition"
+	EventLoopLimitExceeded EventType = "loopLimitExceeded"
+	// EventRunStopped is emitted when the run ends, or stops to wait or pause
+	EventRunStopped EventType = "runStopped"
+)
+
+// Event is an entry of a run's execution history. Fields that do not apply
+// to its type are left empty.
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	State     string    `json:"state,omitempty"`
+	Primitive string    `json:"primitive,omitempty"`
+	// Attempt numbers the executions of a retried primitive, from 1
+	Attempt  int           `json:"attempt,omitempty"`
+	Success  bool          `json:"success,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	// Waited is the part of Duration spent queued behind the primitive's limits
+	Waited time.Duration          `json:"waited,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+	// ErrorCode is the code of a coded error, such as a *core.Error
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Target is the state a transition moves to
+	Target string    `json:"target,omitempty"`
+	Status RunStatus `json:"status,omitempty"`
+}
+
+// emit hands event to the run's OnEvent hook, stamping it with the current
+// state and time
+func (h *runHistory) emit(event Event) {
+	h.mu.Lock()
+	if event.State == "" {
+		event.State = h.state
+	}
+	onEvent := h.onEvent
+	h.mu.Unlock()
+
+	if onEvent == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	onEvent(event)
+}
+
+// recordEvent adds an event to the history of the run carried by ctx, if any
+func recordEvent(ctx context.Context, event Event) {
+	history, ok := ctx.Value(historyKey{}).(*runHistory)
+	if !ok {
+		return
+	}
+	history.emit(event)
+}
+
+// setError records err, with its code if it has one
+func (e *Event) setError(err error) {
+	if err == nil {
+		return
+	}
+	e.Error = err.Error()
+	e.ErrorCode = core.ErrorCode(err)
+}
+
+// setResultError records why an unsuccessful result failed
+func (e *Event) setResultError(result *core.PrimitiveResult) {
+	e.Error = resultError(result)
+	if result.Error != nil {
+		e.ErrorCode = result.Error.Code
+	}
+}
+
+// stateFinished describes the end of a state's actions
+func stateFinished(result *core.PrimitiveResult, err error) Event {
+	event := Event{Type: EventStateFinished}
+	switch {
+	case err != nil:
+		event.setError(err)
+	case result.Success:
+		event.Success = true
+	default:
+		event.setResultError(result)
+	}
+	return event
+}
+
+// primitiveFinished describes the end of a primitive attempt
+func primitiveFinished(name string, attempt int, startedAt time.Time, waited time.Duration, result *core.PrimitiveResult, err error) Event {
+	event := Event{
+		Type:      EventPrimitiveFinished,
+		Primitive: name,
+		Attempt:   attempt,
+		Duration:  time.Since(startedAt),
+		Waited:    waited,
+	}
+	switch {
+	case err != nil:
+		event.setError(err)
+	case result != nil:
+		event.Success = result.Success
+		event.Data = result.Data
+		if !result.Success {
+			event.setResultError(result)
+		}
+	}
+	return event
+}
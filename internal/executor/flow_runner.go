@@ -0,0 +1,384 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// RunStatus describes where a run is in its lifecycle
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusCompleted RunStatus = "completed"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusPaused    RunStatus = "paused"
+	RunStatusCancelled RunStatus = "cancelled"
+	RunStatusWaiting   RunStatus = "waiting"
+	// RunStatusQueued is set by callers on runs waiting for a worker to
+	// execute them; the runner never returns it
+	RunStatusQueued RunStatus = "queued"
+)
+
+// RunResult is the outcome of walking a flow to completion
+type RunResult struct {
+	FinalState    string
+	Status        RunStatus
+	Path          []string
+	Attempts      []Attempt
+	Compensations []Compensation
+	Error         error
+	// Checkpoint is where a paused or waiting run resumes
+	Checkpoint *Checkpoint
+	// StartChild is set when the run waits for the child run of a sub-flow state
+	StartChild *ChildStart
+	// completed are the steps to compensate if a run this one is part of
+	// fails later
+	completed []CompletedStep
+}
+
+// Checkpoint is the durable progress of a run. The runner takes one each
+// time the run enters a state, before executing it, so a run resumed from a
+// checkpoint re-executes that state from the start: primitives get
+// at-least-once semantics.
+type Checkpoint struct {
+	State          string                 `json:"state"`
+	Path           []string               `json:"path"`
+	Data           map[string]interface{} `json:"data"`
+	Attempts       []Attempt              `json:"attempts,omitempty"`
+	CompletedSteps []CompletedStep        `json:"completedSteps,omitempty"`
+	LastError      string                 `json:"lastError,omitempty"`
+	// LastFailure is the coded error behind LastError, if any
+	LastFailure *core.Error `json:"lastFailure,omitempty"`
+	// WakeAt is when the timer of State fires, or its wait for a signal times
+	// out, once the run started waiting
+	WakeAt time.Time `json:"wakeAt"`
+	// ReceivedSignal is the signal State was waiting for, once it arrived
+	ReceivedSignal string `json:"receivedSignal,omitempty"`
+	// Child is how the child run of State ended, once it did
+	Child *ChildResult `json:"child,omitempty"`
+}
+
+// FlowRunner walks state transitions from a start state until a terminal state is reached
+type FlowRunner struct {
+	StateExecutor *StateExecutor
+	// Limits bound how often runs may enter states and how many transitions
+	// they may take
+	Limits core.FlowLimits
+	// OnCheckpoint, when set, is called with every checkpoint the run takes.
+	// A failing checkpoint is logged and the run carries on.
+	OnCheckpoint func(checkpoint *Checkpoint) error
+	// PendingSignal, when set, returns the payload of a signal named name
+	// that was sent before the run reached the state waiting for it. The
+	// state receives such a signal as soon as it is entered.
+	PendingSignal func(name string) (payload map[string]interface{}, ok bool, err error)
+	// OnEvent, when set, is called with every event of the run, in order.
+	// Primitives of concurrent chains emit events from their own goroutines.
+	OnEvent func(event Event)
+}
+
+func NewFlowRunner(stateExecutor *StateExecutor) *FlowRunner {
+	return &FlowRunner{
+		StateExecutor: stateExecutor,
+	}
+}
+
+// Run executes states starting at startState. Terminal states end the run
+// without being executed; their TerminalKind decides the run status. Errors
+// returned by a state follow its failure transition like any other failure,
+// and the last one is reported if the run ends up failing. Cancelling ctx stops
+// the run without following any further transition. A RunControl attached to
+// ctx with WithControl can pause or cancel the run. When a run fails or is
+// cancelled, the compensations of its completed primitives run in reverse
+// order. A state with a timer, a signal to wait for or a sub-flow ends the
+// run as waiting, with a checkpoint to resume from once the timer fires, the
+// signal arrives or the child run ends. A run exceeding the flow's limits
+// fails with a *LoopLimitError.
+func (fr *FlowRunner) Run(ctx context.Context, startState string, execCtx *core.ExecutionContext) *RunResult {
+	return fr.Resume(ctx, &Checkpoint{State: startState}, execCtx)
+}
+
+// Resume continues a run from a checkpoint, executing its state again.
+// execCtx must hold the checkpoint's data.
+func (fr *FlowRunner) Resume(ctx context.Context, checkpoint *Checkpoint, execCtx *core.ExecutionContext) *RunResult {
+	history := &runHistory{
+		attempts:  append([]Attempt(nil), checkpoint.Attempts...),
+		completed: append([]CompletedStep(nil), checkpoint.CompletedSteps...),
+		onEvent:   fr.OnEvent,
+	}
+	ctx = context.WithValue(withHistory(ctx, history), runnerKey{}, fr)
+
+	if len(checkpoint.Path) == 0 {
+		history.emit(Event{Type: EventRunStarted, State: checkpoint.State})
+	} else {
+		history.emit(Event{Type: EventRunResumed, State: checkpoint.State})
+	}
+
+	result := fr.walk(ctx, history, checkpoint, execCtx)
+	if result.Status == RunStatusFailed || result.Status == RunStatusCancelled {
+		// Compensations still run when the run itself was cancelled and
+		// cannot be interrupted
+		compensateCtx := WithControl(context.WithoutCancel(ctx), nil)
+		result.Compensations = fr.compensate(compensateCtx, history, execCtx)
+	}
+	result.Attempts = history.snapshot()
+	if result.Status == RunStatusCompleted {
+		result.completed = history.completedSteps()
+	}
+
+	stopped := Event{Type: EventRunStopped, State: result.FinalState, Status: result.Status}
+	stopped.setError(result.Error)
+	history.emit(stopped)
+	return result
+}
+
+type runnerKey struct{}
+
+// nestedRunner returns a runner for a flow that runs as part of the run
+// carried by ctx, such as the flow of a map item. It shares the limits and
+// the events of that run's runner; starting and stopping the nested flow are
+// not events of the run.
+func nestedRunner(ctx context.Context, se *StateExecutor) *FlowRunner {
+	runner := NewFlowRunner(se)
+	parent, ok := ctx.Value(runnerKey{}).(*FlowRunner)
+	if !ok {
+		return runner
+	}
+	runner.Limits = parent.Limits
+	if onEvent := parent.OnEvent; onEvent != nil {
+		runner.OnEvent = func(event Event) {
+			switch event.Type {
+			case EventRunStarted, EventRunResumed, EventRunStopped:
+				return
+			}
+			onEvent(event)
+		}
+	}
+	return runner
+}
+
+func (fr *FlowRunner) walk(ctx context.Context, history *runHistory, checkpoint *Checkpoint, execCtx *core.ExecutionContext) *RunResult {
+	result := &RunResult{
+		Path: append([]string(nil), checkpoint.Path...),
+	}
+	currentState := checkpoint.State
+	wakeAt, received, child := checkpoint.WakeAt, checkpoint.ReceivedSignal, checkpoint.Child
+	var lastErr error
+	if checkpoint.LastError != "" {
+		lastErr = &restoredError{message: checkpoint.LastError, failure: checkpoint.LastFailure}
+	}
+
+	// A resumed run is already in its checkpoint state
+	if n := len(result.Path); n > 0 && result.Path[n-1] == currentState {
+		result.Path = result.Path[:n-1]
+	}
+
+	for {
+		history.enterState(currentState)
+		history.emit(Event{Type: EventStateEntered})
+		result.Path = append(result.Path, currentState)
+		result.FinalState = currentState
+
+		state, exists := fr.StateExecutor.StateDefinitions[currentState]
+		if !exists {
+			return fr.fail(result, fmt.Errorf("state not found: %s", currentState))
+		}
+
+		if state.IsTerminal() {
+			if state.Terminal == core.TerminalFailure {
+				return fr.fail(result, lastErr)
+			}
+			result.Status = RunStatusCompleted
+			return result
+		}
+
+		if limitErr := fr.checkLimits(result.Path, state); limitErr != nil {
+			exceeded := Event{Type: EventLoopLimitExceeded, Data: map[string]interface{}{"cycle": limitErr.Cycle}}
+			exceeded.setError(limitErr)
+			history.emit(exceeded)
+			return fr.fail(result, limitErr)
+		}
+
+		// Wakeups and received signals are part of the checkpoint so a crash
+		// does not restart a timer or lose a signal
+		var waitErr error
+		wakeAt, waitErr = stateWakeup(state, wakeAt, execCtx)
+		if state.WaitFor == nil {
+			received = ""
+		} else if received != state.WaitFor.Signal && fr.PendingSignal != nil {
+			payload, ok, err := fr.PendingSignal(state.WaitFor.Signal)
+			if err != nil {
+				log.Printf("Looking up signal %s for state %s failed: %v", state.WaitFor.Signal, currentState, err)
+			} else if ok {
+				execCtx.Merge(payload)
+				received = state.WaitFor.Signal
+			}
+		}
+		if state.SubFlow == nil {
+			child = nil
+		}
+
+		checkpoint := fr.checkpoint(history, result, execCtx, lastErr, wakeAt, received, child)
+		if signal := controlSignal(ctx); signal != SignalNone {
+			return fr.interrupt(result, signal, checkpoint)
+		}
+
+		var nextState string
+		var err error
+		switch {
+		case waitErr != nil:
+			nextState, err = failureTransition(state, waitErr), waitErr
+		case state.WaitFor != nil && received != state.WaitFor.Signal:
+			if wakeAt.IsZero() || time.Now().Before(wakeAt) {
+				return fr.wait(result, checkpoint)
+			}
+			nextState, err = signalTimeout(state)
+		case state.Timer != nil && time.Now().Before(wakeAt):
+			return fr.wait(result, checkpoint)
+		case state.SubFlow != nil && child == nil:
+			var waiting *RunResult
+			if waiting, err = fr.startChild(result, checkpoint, state, execCtx); err == nil {
+				return waiting
+			}
+			nextState = failureTransition(state, err)
+		case state.SubFlow != nil:
+			nextState, err = fr.finishSubFlow(ctx, state, child, execCtx)
+		default:
+			nextState, err = fr.StateExecutor.ExecuteState(ctx, currentState, execCtx)
+		}
+		wakeAt, received, child = time.Time{}, "", nil
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fr.fail(result, fmt.Errorf("state %s: %w", currentState, ctxErr))
+		}
+		var interruptedErr *InterruptedError
+		if errors.As(err, &interruptedErr) {
+			// The interrupted state runs again from the start on resume. The
+			// request is taken from the error since a resume may have
+			// withdrawn it from the control meanwhile.
+			return fr.interrupt(result, interruptedErr.Signal, checkpoint)
+		}
+		if err != nil {
+			log.Printf("State %s failed: %v", currentState, err)
+			lastErr = fmt.Errorf("state %s: %w", currentState, err)
+		}
+		if nextState != "" && nextState != core.NoTransition {
+			transition := Event{Type: EventTransition, Target: nextState}
+			transition.setError(err)
+			history.emit(transition)
+		}
+
+		if nextState == "" || nextState == core.NoTransition {
+			if err != nil {
+				return fr.fail(result, lastErr)
+			}
+			return fr.fail(result, fmt.Errorf("state %s has no transition to follow", currentState))
+		}
+
+		currentState = nextState
+	}
+}
+
+// stateWakeup returns when a run entering state wakes up: the wakeup of its
+// timer or the deadline of its wait for a signal. A wakeup restored from a
+// checkpoint is kept.
+func stateWakeup(state core.StateDefinition, restored time.Time, execCtx *core.ExecutionContext) (time.Time, error) {
+	switch {
+	case state.Timer != nil:
+		if !restored.IsZero() {
+			return restored, nil
+		}
+		return state.Timer.WakeAt(time.Now(), execCtx.Snapshot())
+	case state.WaitFor != nil && state.WaitFor.Timeout > 0:
+		if !restored.IsZero() {
+			return restored, nil
+		}
+		return time.Now().Add(state.WaitFor.Timeout.Duration()), nil
+	}
+	return time.Time{}, nil
+}
+
+// signalTimeout returns the transition of a state whose signal did not arrive in time
+func signalTimeout(state core.StateDefinition) (string, error) {
+	if target, declared := state.Transitions[core.OutcomeTimeout]; declared {
+		return target, nil
+	}
+	return state.Transitions[core.OutcomeFailure], fmt.Errorf("signal %s did not arrive within %s", state.WaitFor.Signal, state.WaitFor.Timeout.Duration())
+}
+
+// wait ends the run until the timer of its current state fires or its signal arrives
+func (fr *FlowRunner) wait(result *RunResult, checkpoint *Checkpoint) *RunResult {
+	result.Status = RunStatusWaiting
+	result.Checkpoint = checkpoint
+	return result
+}
+
+// checkpoint captures the run as it enters its current state and hands it to
+// OnCheckpoint
+func (fr *FlowRunner) checkpoint(history *runHistory, result *RunResult, execCtx *core.ExecutionContext, lastErr error, wakeAt time.Time, received string, child *ChildResult) *Checkpoint {
+	history.mu.Lock()
+	checkpoint := &Checkpoint{
+		State:          result.FinalState,
+		Path:           append([]string(nil), result.Path...),
+		Data:           execCtx.Snapshot(),
+		Attempts:       append([]Attempt(nil), history.attempts...),
+		CompletedSteps: append([]CompletedStep(nil), history.completed...),
+		WakeAt:         wakeAt,
+		ReceivedSignal: received,
+		Child:          child,
+	}
+	history.mu.Unlock()
+	if lastErr != nil {
+		checkpoint.LastError = lastErr.Error()
+		checkpoint.LastFailure = core.AsError(lastErr)
+	}
+
+	if fr.OnCheckpoint != nil {
+		if err := fr.OnCheckpoint(checkpoint); err != nil {
+			log.Printf("Checkpoint at state %s failed: %v", checkpoint.State, err)
+		}
+	}
+	return checkpoint
+}
+
+// restoredError is an error read back from a checkpoint. It keeps the coded
+// error it was caused by so the run result still reports it.
+type restoredError struct {
+	message string
+	failure *core.Error
+}
+
+func (e *restoredError) Error() string {
+	return e.message
+}
+
+func (e *restoredError) Unwrap() error {
+	if e.failure == nil {
+		return nil
+	}
+	return e.failure
+}
+
+// interrupt ends the run on a pause or cancel signal. A paused run keeps the
+// checkpoint of the state it stopped in.
+func (fr *FlowRunner) interrupt(result *RunResult, signal Signal, checkpoint *Checkpoint) *RunResult {
+	if signal == SignalCancel {
+		result.Status = RunStatusCancelled
+		result.Error = fmt.Errorf("run cancelled in state %s", checkpoint.State)
+		return result
+	}
+	result.Status = RunStatusPaused
+	result.Checkpoint = checkpoint
+	return result
+}
+
+func (fr *FlowRunner) fail(result *RunResult, err error) *RunResult {
+	result.Status = RunStatusFailed
+	result.Error = err
+	return result
+}
@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+func TestPendingSignalIsReceivedOnEntry(t *testing.T) {
+	se := NewStateExecutor()
+	se.StateDefinitions["Wait"] = core.StateDefinition{
+		Name:        "Wait",
+		WaitFor:     &core.WaitForSignal{Signal: "paid"},
+		Transitions: core.Transitions{core.OutcomeSuccess: "Done"},
+	}
+	se.StateDefinitions["Done"] = core.StateDefinition{Name: "Done", Terminal: core.TerminalSuccess}
+
+	fr := NewFlowRunner(se)
+	result := fr.Run(context.Background(), "Wait", core.NewExecutionContext())
+	if result.Status != RunStatusWaiting {
+		t.Fatalf("got status %s without a pending signal, want %s", result.Status, RunStatusWaiting)
+	}
+
+	var asked []string
+	var checkpoints []*Checkpoint
+	fr.PendingSignal = func(name string) (map[string]interface{}, bool, error) {
+		asked = append(asked, name)
+		return map[string]interface{}{"amount": 10.0}, true, nil
+	}
+	fr.OnCheckpoint = func(checkpoint *Checkpoint) error {
+		checkpoints = append(checkpoints, checkpoint)
+		return nil
+	}
+
+	execCtx := core.NewExecutionContext()
+	result = fr.Resume(context.Background(), result.Checkpoint, execCtx)
+	if result.Status != RunStatusCompleted || result.FinalState != "Done" {
+		t.Fatalf("got status %s at %s, want completed at Done", result.Status, result.FinalState)
+	}
+	if len(asked) != 1 || asked[0] != "paid" {
+		t.Errorf("asked for signals %v, want [paid]", asked)
+	}
+	if amount, _ := execCtx.Lookup("amount"); amount != 10.0 {
+		t.Errorf("got amount %v, want the payload merged into the context", amount)
+	}
+	if len(checkpoints) == 0 {
+		t.Fatal("no checkpoint taken")
+	}
+	if checkpoint := checkpoints[0]; checkpoint.ReceivedSignal != "paid" || checkpoint.Data["amount"] != 10.0 {
+		t.Errorf("got checkpoint %+v, want it to record the received signal and its payload", checkpoint)
+	}
+}
+
+func TestPauseStopsRetries(t *testing.T) {
+	control := NewRunControl()
+	calls := 0
+	se := NewStateExecutor()
+	se.ChainExecutor.PrimitiveRegistry["flaky"] = primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		calls++
+		// Paused during the first attempt, before its backoff starts
+		control.Pause()
+		return nil, errors.New("unavailable")
+	})
+	se.StateDefinitions["Call"] = core.StateDefinition{
+		Name:       "Call",
+		MainAction: "flaky",
+		MainActionOptions: &core.PrimitiveOptions{
+			Retry: &core.RetryPolicy{MaxAttempts: 5, InitialInterval: core.Duration(time.Hour)},
+		},
+		Transitions: core.Transitions{core.OutcomeFailure: "Failed"},
+	}
+	se.StateDefinitions["Failed"] = core.StateDefinition{Name: "Failed", Terminal: core.TerminalFailure}
+
+	started := time.Now()
+	result := NewFlowRunner(se).Run(WithControl(context.Background(), control), "Call", core.NewExecutionContext())
+	if result.Status != RunStatusPaused || result.FinalState != "Call" {
+		t.Fatalf("got status %s at %s, want paused at Call", result.Status, result.FinalState)
+	}
+	if calls != 1 || time.Since(started) > time.Second {
+		t.Errorf("primitive called %d times in %s, want once without waiting for the backoff", calls, time.Since(started))
+	}
+}
+
+func TestPauseWakesBackoff(t *testing.T) {
+	control := NewRunControl()
+	ctx := WithControl(context.Background(), control)
+	time.AfterFunc(20*time.Millisecond, control.Pause)
+
+	err := waitBackoff(ctx, &core.RetryPolicy{MaxAttempts: 2, InitialInterval: core.Duration(time.Hour)}, 1)
+	var interruptedErr *InterruptedError
+	if !errors.As(err, &interruptedErr) || interruptedErr.Signal != SignalPause || !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("got error %v, want an *InterruptedError for a pause", err)
+	}
+}
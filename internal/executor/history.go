@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempt records one execution of a primitive, or of a whole state when
+// Primitive is empty
+type Attempt struct {
+	State     string        `json:"state"`
+	Primitive string        `json:"primitive,omitempty"`
+	Number    int           `json:"number"`
+	Success   bool          `json:"success"`
+	Error     string        `json:"error,omitempty"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	// Waited is the part of Duration spent queued behind the primitive's limits
+	Waited time.Duration `json:"waited,omitempty"`
+}
+
+// runHistory collects the attempts and events of a single run. It travels
+// in the context so the shared chain executor can record into the right run.
+type runHistory struct {
+	mu        sync.Mutex
+	state     string
+	attempts  []Attempt
+	completed []CompletedStep
+	onEvent   func(Event)
+}
+
+type historyKey struct{}
+
+func withHistory(ctx context.Context, history *runHistory) context.Context {
+	return context.WithValue(ctx, historyKey{}, history)
+}
+
+func (h *runHistory) enterState(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = name
+}
+
+func (h *runHistory) completedSteps() []CompletedStep {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]CompletedStep(nil), h.completed...)
+}
+
+// adoptNested adds the attempts of a nested flow, such as the flow of a map
+// item, to the run history carried by ctx, along with the steps to compensate
+// if the run fails later
+func adoptNested(ctx context.Context, nested *RunResult) {
+	history, ok := ctx.Value(historyKey{}).(*runHistory)
+	if !ok {
+		return
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	history.attempts = append(history.attempts, nested.Attempts...)
+	history.completed = append(history.completed, nested.completed...)
+}
+
+func (h *runHistory) snapshot() []Attempt {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Attempt(nil), h.attempts...)
+}
+
+// recordAttempt adds an attempt to the run history carried by ctx, if any
+func recordAttempt(ctx context.Context, primitive string, number int, startedAt time.Time, waited time.Duration, success bool, err error) {
+	history, ok := ctx.Value(historyKey{}).(*runHistory)
+	if !ok {
+		return
+	}
+
+	attempt := Attempt{
+		Primitive: primitive,
+		Number:    number,
+		Success:   success && err == nil,
+		StartedAt: startedAt,
+		Duration:  time.Since(startedAt),
+		Waited:    waited,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	attempt.State = history.state
+	history.attempts = append(history.attempts, attempt)
+}
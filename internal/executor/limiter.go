@@ -0,0 +1,142 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// CodeRateLimited is the code of the error returned for calls rejected by a
+// primitive's limits
+const CodeRateLimited = "RATE_LIMITED"
+
+// LimitConfig throttles calls to primitives across all runs of the process
+type LimitConfig struct {
+	// Rate is the number of calls per second allowed on average. Zero means
+	// no rate limit.
+	Rate float64 `json:"rate,omitempty"`
+	// Burst is how many calls may start at once after a quiet period.
+	// Defaults to 1.
+	Burst int `json:"burst,omitempty"`
+	// MaxInFlight caps the calls running at the same time. Zero means no cap.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+	// Reject fails calls that would have to wait with a transient *core.Error
+	// coded CodeRateLimited instead of queueing them
+	Reject bool `json:"reject,omitempty"`
+}
+
+func (c LimitConfig) Validate() error {
+	if c.Rate < 0 || c.Burst < 0 || c.MaxInFlight < 0 {
+		return errors.New("rate, burst and maxInFlight must not be negative")
+	}
+	if c.Rate == 0 && c.MaxInFlight == 0 {
+		return errors.New("set rate, maxInFlight or both")
+	}
+	return nil
+}
+
+// Limiter is a token bucket combined with a cap on calls in flight
+type Limiter struct {
+	config LimitConfig
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// now is replaced by tests
+	now func() time.Time
+}
+
+func NewLimiter(config LimitConfig) *Limiter {
+	if config.Burst < 1 {
+		config.Burst = 1
+	}
+	limiter := &Limiter{config: config, tokens: float64(config.Burst), last: time.Now(), now: time.Now}
+	if config.MaxInFlight > 0 {
+		limiter.slots = make(chan struct{}, config.MaxInFlight)
+	}
+	return limiter
+}
+
+// acquire waits until a call to primitive may start and returns how long it
+// waited and the function to call once the call is done
+func (l *Limiter) acquire(ctx context.Context, primitive string) (time.Duration, func(), error) {
+	if l == nil {
+		return 0, func() {}, nil
+	}
+	start := l.now()
+
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if l.config.Reject {
+				return 0, nil, l.rejected(primitive, "too many calls in flight")
+			}
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return l.now().Sub(start), nil, ctx.Err()
+			}
+		}
+		release = func() { <-l.slots }
+	}
+
+	if err := l.take(ctx, primitive); err != nil {
+		release()
+		return l.now().Sub(start), nil, err
+	}
+	return l.now().Sub(start), release, nil
+}
+
+// take takes a token from the bucket, waiting for one if needed
+func (l *Limiter) take(ctx context.Context, primitive string) error {
+	if l.config.Rate == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	l.tokens = math.Min(float64(l.config.Burst), l.tokens+now.Sub(l.last).Seconds()*l.config.Rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if l.config.Reject {
+		l.mu.Unlock()
+		return l.rejected(primitive, fmt.Sprintf("rate limit of %g calls per second reached", l.config.Rate))
+	}
+	// Reserve the next token; callers queue up behind each other
+	wait := time.Duration((1 - l.tokens) / l.config.Rate * float64(time.Second))
+	l.tokens--
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) rejected(primitive, reason string) *core.Error {
+	return &core.Error{
+		Code:      CodeRateLimited,
+		Message:   fmt.Sprintf("primitive %s: %s", primitive, reason),
+		Transient: true,
+		Details:   map[string]interface{}{"primitive": primitive},
+	}
+}
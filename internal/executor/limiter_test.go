@@ -0,0 +1,157 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// newTestLimiter returns a limiter reading the time from clock
+func newTestLimiter(config LimitConfig, clock *fakeClock) *Limiter {
+	limiter := NewLimiter(config)
+	limiter.now = clock.now
+	limiter.last = clock.now()
+	return limiter
+}
+
+func TestLimiterRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		// calls is how many calls are made after advancing, allowed how many
+		// of them get through
+		calls   int
+		allowed int
+	}{
+		{"burst", 0, 3, 2},
+		{"partial refill", 500 * time.Millisecond, 1, 0},
+		{"full token", 500 * time.Millisecond, 2, 1},
+		{"refill is capped by burst", time.Minute, 3, 2},
+	}
+
+	clock := newFakeClock()
+	limiter := newTestLimiter(LimitConfig{Rate: 1, Burst: 2, Reject: true}, clock)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock.advance(test.advance)
+			allowed := 0
+			for i := 0; i < test.calls; i++ {
+				_, release, err := limiter.acquire(context.Background(), "charge")
+				if err != nil {
+					if code := core.ErrorCode(err); code != CodeRateLimited {
+						t.Fatalf("got code %q, want %q", code, CodeRateLimited)
+					}
+					if coded := core.AsError(err); !coded.Transient {
+						t.Errorf("got permanent error %v, want transient", err)
+					}
+					continue
+				}
+				release()
+				allowed++
+			}
+			if allowed != test.allowed {
+				t.Errorf("got %d of %d calls allowed, want %d", allowed, test.calls, test.allowed)
+			}
+		})
+	}
+}
+
+func TestLimiterWaitsForToken(t *testing.T) {
+	limiter := NewLimiter(LimitConfig{Rate: 50})
+	if _, release, err := limiter.acquire(context.Background(), "charge"); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+
+	waited, release, err := limiter.acquire(context.Background(), "charge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if waited < 10*time.Millisecond {
+		t.Errorf("got wait of %s, want about 20ms", waited)
+	}
+}
+
+func TestLimiterCancelWhileWaiting(t *testing.T) {
+	tests := []struct {
+		name   string
+		config LimitConfig
+	}{
+		{"rate", LimitConfig{Rate: 1}},
+		{"in flight", LimitConfig{MaxInFlight: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock()
+			limiter := newTestLimiter(test.config, clock)
+			_, release, err := limiter.acquire(context.Background(), "charge")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.config.Rate > 0 {
+				// Rate limited calls hold nothing once started
+				release()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				_, _, err := limiter.acquire(ctx, "charge")
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				t.Fatalf("got %v before cancelling, want the call to wait", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			cancel()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("got %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("call still waiting after cancelling")
+			}
+
+			if test.config.Rate > 0 {
+				// The token reserved by the cancelled call is given back
+				limiter.mu.Lock()
+				tokens := limiter.tokens
+				limiter.mu.Unlock()
+				if tokens != 0 {
+					t.Errorf("got %g tokens, want 0", tokens)
+				}
+				return
+			}
+			release()
+			if len(limiter.slots) != 0 {
+				t.Errorf("got %d slots taken, want 0", len(limiter.slots))
+			}
+		})
+	}
+}
+
+func TestLimiterRejectsInFlight(t *testing.T) {
+	limiter := NewLimiter(LimitConfig{MaxInFlight: 1, Reject: true})
+	_, release, err := limiter.acquire(context.Background(), "charge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := limiter.acquire(context.Background(), "charge"); core.ErrorCode(err) != CodeRateLimited {
+		t.Fatalf("got %v, want a %s error", err, CodeRateLimited)
+	}
+	release()
+	if _, release, err := limiter.acquire(context.Background(), "charge"); err != nil {
+		t.Fatalf("got %v after release, want the call to start", err)
+	} else {
+		release()
+	}
+}
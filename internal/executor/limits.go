@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// DefaultMaxTransitions is the transition budget of runs whose flow sets none
+const DefaultMaxTransitions = 1000
+
+// ErrLoopLimitExceeded is wrapped by the errors of runs stopped by their flow's limits
+var ErrLoopLimitExceeded = errors.New("loop limit exceeded")
+
+// LoopLimitError reports a run that entered a state more often than allowed or
+// ran out of its transition budget. Runs stopped by it fail without
+// following any transition.
+type LoopLimitError struct {
+	State string
+	// Limit is "maxVisits" or "maxTransitions"
+	Limit string
+	Max   int
+	// Cycle is the path from the previous visit of State back to it, empty
+	// when State was not visited before
+	Cycle []string
+}
+
+func (e *LoopLimitError) Error() string {
+	message := fmt.Sprintf("%v: state %s exceeded %s of %d", ErrLoopLimitExceeded, e.State, e.Limit, e.Max)
+	if len(e.Cycle) > 0 {
+		message += fmt.Sprintf(" in cycle %s", strings.Join(e.Cycle, " -> "))
+	}
+	return message
+}
+
+func (e *LoopLimitError) ErrorCode() string {
+	return core.CodeLoopLimitExceeded
+}
+
+func (e *LoopLimitError) Unwrap() error {
+	return ErrLoopLimitExceeded
+}
+
+// checkLimits checks a run whose path ends in state, just entered, against
+// the state's and the flow's limits
+func (fr *FlowRunner) checkLimits(path []string, state core.StateDefinition) *LoopLimitError {
+	maxVisits := state.MaxVisits
+	if maxVisits == 0 {
+		maxVisits = fr.Limits.MaxVisits
+	}
+	if maxVisits > 0 {
+		visits := 0
+		for _, visited := range path {
+			if visited == state.Name {
+				visits++
+			}
+		}
+		if visits > maxVisits {
+			return &LoopLimitError{State: state.Name, Limit: "maxVisits", Max: maxVisits, Cycle: cycle(path)}
+		}
+	}
+
+	maxTransitions := fr.Limits.MaxTransitions
+	if maxTransitions == 0 {
+		maxTransitions = DefaultMaxTransitions
+	}
+	if len(path)-1 > maxTransitions {
+		return &LoopLimitError{State: state.Name, Limit: "maxTransitions", Max: maxTransitions, Cycle: cycle(path)}
+	}
+	return nil
+}
+
+// cycle returns the end of path from the previous visit of its last state
+func cycle(path []string) []string {
+	last := len(path) - 1
+	for i := last - 1; i >= 0; i-- {
+		if path[i] == path[last] {
+			return append([]string(nil), path[i:]...)
+		}
+	}
+	return nil
+}
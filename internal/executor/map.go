@@ -0,0 +1,180 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/aliatli/reactor/internal/core"
+	"github.com/aliatli/reactor/internal/expr"
+)
+
+// mapItem is the outcome of running a map state's chain or flow for one element
+type mapItem struct {
+	started bool
+	success bool
+	data    map[string]interface{}
+	err     error
+}
+
+// executeMap runs the state's map over its list with bounded concurrency and
+// stores the results in the context. Once more elements fail than the map
+// tolerates, elements that have not started are skipped and the state fails.
+func (se *StateExecutor) executeMap(ctx context.Context, state core.StateDefinition, execCtx *core.ExecutionContext) error {
+	spec := state.Map
+	items, err := mapItems(spec.Items, execCtx.Snapshot())
+	if err != nil {
+		return fmt.Errorf("map: %w", err)
+	}
+
+	mapCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := spec.MaxConcurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	slots := make(chan struct{}, limit)
+	results := make([]mapItem, len(items))
+	var mu sync.Mutex
+	failures := 0
+	var wg sync.WaitGroup
+	var panicked goroutinePanic
+
+dispatch:
+	for i, item := range items {
+		select {
+		case slots <- struct{}{}:
+		case <-mapCtx.Done():
+			break dispatch
+		}
+
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer panicked.capture(cancel)
+
+			itemCtx := execCtx.Clone()
+			itemCtx.Set(spec.ItemKeyOrDefault(), item)
+			result := se.executeMapItem(mapCtx, spec, itemCtx)
+			if result.success {
+				results[i] = result
+				return
+			}
+			// Elements stopped by the map itself are skipped, not failed
+			if ctx.Err() == nil && errors.Is(result.err, context.Canceled) {
+				return
+			}
+			results[i] = result
+
+			mu.Lock()
+			defer mu.Unlock()
+			failures++
+			if failures > spec.ToleratedFailures {
+				cancel()
+			}
+		}(i, item)
+	}
+	wg.Wait()
+	panicked.raise()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if errors.Is(result.err, ErrInterrupted) {
+			return result.err
+		}
+	}
+
+	execCtx.Set(spec.ResultKeyOrDefault(), mapResults(results))
+	if failures > spec.ToleratedFailures {
+		return fmt.Errorf("%d of %d map items failed, tolerating %d", failures, len(items), spec.ToleratedFailures)
+	}
+	return nil
+}
+
+func (se *StateExecutor) executeMapItem(ctx context.Context, spec *core.Map, itemCtx *core.ExecutionContext) mapItem {
+	if spec.Chain != nil {
+		result, err := se.ChainExecutor.Execute(ctx, *spec.Chain, itemCtx)
+		if err != nil {
+			return mapItem{started: true, err: err}
+		}
+		return mapItem{started: true, success: result.Success, data: result.Data}
+	}
+
+	before := itemCtx.Snapshot()
+	run := nestedRunner(ctx, se).Run(ctx, spec.StartState, itemCtx)
+	adoptNested(ctx, run)
+	item := mapItem{started: true, data: writtenData(before, itemCtx.Snapshot()), err: run.Error}
+	switch run.Status {
+	case RunStatusCompleted:
+		item.success = true
+	case RunStatusPaused:
+		item.err = &InterruptedError{Signal: SignalPause}
+	case RunStatusCancelled:
+		item.err = &InterruptedError{Signal: SignalCancel}
+	case RunStatusWaiting:
+		item.err = fmt.Errorf("flow %s cannot wait inside a map state", spec.StartState)
+	default:
+		if item.err == nil {
+			item.err = fmt.Errorf("flow %s ended %s at state %s", spec.StartState, run.Status, run.FinalState)
+		}
+	}
+	return item
+}
+
+// mapItems evaluates the expression selecting a map state's list
+func mapItems(source string, data map[string]interface{}) ([]interface{}, error) {
+	expression, err := expr.Compile(source)
+	if err != nil {
+		return nil, fmt.Errorf("items: %w", err)
+	}
+	value, err := expression.Eval(data)
+	if err != nil {
+		return nil, fmt.Errorf("items: %w", err)
+	}
+
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, fmt.Errorf("items %q evaluated to %v, not a list", source, value)
+	}
+	items := make([]interface{}, list.Len())
+	for i := range items {
+		items[i] = list.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// mapResults converts the results into the list stored in the context
+func mapResults(results []mapItem) []interface{} {
+	list := make([]interface{}, len(results))
+	for i, result := range results {
+		entry := map[string]interface{}{
+			"success": result.success,
+			"data":    result.data,
+		}
+		switch {
+		case !result.started:
+			entry["error"] = "skipped"
+		case result.err != nil:
+			entry["error"] = result.err.Error()
+		}
+		list[i] = entry
+	}
+	return list
+}
+
+// writtenData returns the entries of after that are new or changed since before
+func writtenData(before, after map[string]interface{}) map[string]interface{} {
+	written := make(map[string]interface{})
+	for k, v := range after {
+		if previous, exists := before[k]; !exists || !reflect.DeepEqual(previous, v) {
+			written[k] = v
+		}
+	}
+	return written
+}
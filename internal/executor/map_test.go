@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// mapFlow sets up a map state running the Reserve flow for each item, then
+// a Charge state that fails
+func mapFlow(se *StateExecutor) {
+	succeed := primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		return &core.PrimitiveResult{Success: true}, nil
+	})
+	se.ChainExecutor.PrimitiveRegistry["reserve"] = succeed
+	se.ChainExecutor.PrimitiveRegistry["release"] = succeed
+	se.ChainExecutor.PrimitiveRegistry["charge"] = primitiveFunc(func(context.Context, *core.ExecutionContext) (*core.PrimitiveResult, error) {
+		return &core.PrimitiveResult{Success: false}, nil
+	})
+
+	se.StateDefinitions["ReserveAll"] = core.StateDefinition{
+		Name:        "ReserveAll",
+		Map:         &core.Map{Items: "items", StartState: "Reserve", MaxConcurrency: 2},
+		Transitions: core.Transitions{core.OutcomeSuccess: "Charge", core.OutcomeFailure: "Failed"},
+	}
+	se.StateDefinitions["Reserve"] = core.StateDefinition{
+		Name:              "Reserve",
+		MainAction:        "reserve",
+		MainActionOptions: &core.PrimitiveOptions{Compensation: "release"},
+		Transitions:       core.Transitions{core.OutcomeSuccess: "Reserved"},
+	}
+	se.StateDefinitions["Reserved"] = core.StateDefinition{Name: "Reserved", Terminal: core.TerminalSuccess}
+	se.StateDefinitions["Charge"] = core.StateDefinition{
+		Name:        "Charge",
+		MainAction:  "charge",
+		Transitions: core.Transitions{core.OutcomeFailure: "Failed"},
+	}
+	se.StateDefinitions["Failed"] = core.StateDefinition{Name: "Failed", Terminal: core.TerminalFailure}
+}
+
+func TestMapItemFlowsArePartOfTheRun(t *testing.T) {
+	se := NewStateExecutor()
+	mapFlow(se)
+	fr := NewFlowRunner(se)
+	var stopped, itemStates int
+	fr.OnEvent = func(event Event) {
+		switch {
+		case event.Type == EventRunStopped:
+			stopped++
+		case event.Type == EventStateEntered && event.State == "Reserve":
+			itemStates++
+		}
+	}
+
+	execCtx := core.NewExecutionContext()
+	execCtx.Set("items", []interface{}{"a", "b", "c"})
+	result := fr.Run(context.Background(), "ReserveAll", execCtx)
+	if result.Status != RunStatusFailed {
+		t.Fatalf("got status %s, want failed", result.Status)
+	}
+
+	if itemStates != 3 || stopped != 1 {
+		t.Errorf("got %d item state events and %d runStopped events, want 3 and 1", itemStates, stopped)
+	}
+	reserves := 0
+	for _, attempt := range result.Attempts {
+		if attempt.Primitive == "reserve" {
+			reserves++
+		}
+	}
+	if reserves != 3 {
+		t.Errorf("got %d attempts of the item flows, want 3", reserves)
+	}
+	if len(result.Compensations) != 3 {
+		t.Fatalf("got compensations %+v, want one per item", result.Compensations)
+	}
+	for _, compensation := range result.Compensations {
+		if compensation.State != "Reserve" || compensation.Compensation != "release" || !compensation.Success {
+			t.Errorf("got compensation %+v, want release of Reserve", compensation)
+		}
+	}
+}
+
+func TestMapItemFlowsKeepLimits(t *testing.T) {
+	se := NewStateExecutor()
+	mapFlow(se)
+	// Items loop until the run's visit cap stops them
+	se.StateDefinitions["Reserve"] = core.StateDefinition{
+		Name:        "Reserve",
+		MainAction:  "reserve",
+		Transitions: core.Transitions{core.OutcomeSuccess: "Reserve"},
+	}
+	fr := NewFlowRunner(se)
+	fr.Limits = core.FlowLimits{MaxVisits: 3}
+
+	execCtx := core.NewExecutionContext()
+	execCtx.Set("items", []interface{}{"a"})
+	result := fr.Run(context.Background(), "ReserveAll", execCtx)
+
+	if result.Status != RunStatusFailed {
+		t.Fatalf("got status %s, want failed", result.Status)
+	}
+	results, _ := execCtx.Lookup("results")
+	item := results.([]interface{})[0].(map[string]interface{})
+	if message, _ := item["error"].(string); !strings.Contains(message, ErrLoopLimitExceeded.Error()) || !strings.Contains(message, "of 3") {
+		t.Errorf("got item error %q, want the item flow stopped by the run's visit cap", message)
+	}
+}
@@ -0,0 +1,229 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// groupChains orders chains by ExecutionOrder and groups chains sharing an
+// order. Chains keep their declaration order within a group.
+func groupChains(chains []core.PrimitiveChain) [][]core.PrimitiveChain {
+	sorted := append([]core.PrimitiveChain(nil), chains...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ExecutionOrder < sorted[j].ExecutionOrder
+	})
+
+	var groups [][]core.PrimitiveChain
+	for i, chain := range sorted {
+		if i == 0 || chain.ExecutionOrder != sorted[i-1].ExecutionOrder {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], chain)
+	}
+	return groups
+}
+
+// executeConcurrently runs a group of chains in parallel. Each chain works on
+// its own clone of the context; once all succeed their writes are merged into
+// execCtx in declaration order following the state's merge policy. The first
+// failing chain cancels its siblings, fails the group and nothing is merged.
+// If chains choose an outcome or a next state, the first one in declaration
+// order wins.
+func (se *StateExecutor) executeConcurrently(ctx context.Context, state core.StateDefinition, group []core.PrimitiveChain, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	groupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*core.PrimitiveResult, len(group))
+	errs := make([]error, len(group))
+	var wg sync.WaitGroup
+	var panicked goroutinePanic
+	for i, chain := range group {
+		wg.Add(1)
+		go func(i int, chain core.PrimitiveChain) {
+			defer wg.Done()
+			defer panicked.capture(cancel)
+			results[i], errs[i] = se.ChainExecutor.Execute(groupCtx, chain, execCtx.Clone())
+			if errs[i] != nil || !results[i].Success {
+				cancel()
+			}
+		}(i, chain)
+	}
+	wg.Wait()
+	panicked.raise()
+
+	if err := firstChainError(ctx, results, errs); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		// Chains cancelled by a failing sibling have no result
+		if result != nil && !result.Success {
+			return result, nil
+		}
+	}
+
+	if err := mergeChainData(state, results, execCtx); err != nil {
+		return nil, err
+	}
+
+	merged := &core.PrimitiveResult{Success: true}
+	for _, result := range results {
+		if result.Routes() {
+			merged.Outcome = result.Outcome
+			merged.NextState = result.NextState
+			break
+		}
+	}
+	return merged, nil
+}
+
+// firstChainError picks the error that caused the group to fail rather than
+// the cancellation it triggered in the other chains
+func firstChainError(ctx context.Context, results []*core.PrimitiveResult, errs []error) error {
+	var cancelled error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if ctx.Err() == nil && errors.Is(err, context.Canceled) {
+			cancelled = err
+			continue
+		}
+		return err
+	}
+	for _, result := range results {
+		if result != nil && !result.Success {
+			return nil
+		}
+	}
+	return cancelled
+}
+
+// mergeChainData merges the writes of concurrent chains into execCtx. Each
+// chain reports whole top-level values taken from its clone of the context,
+// so only the leaves a chain changed count as its writes: chains writing
+// different keys of the same object, as with output paths $.out.a and
+// $.out.b, do not conflict.
+func mergeChainData(state core.StateDefinition, results []*core.PrimitiveResult, execCtx *core.ExecutionContext) error {
+	before := execCtx.Snapshot()
+	merged := make(map[string]interface{})
+	for _, result := range results {
+		if err := mergeChanges(state, merged, changedLeaves(before, result.Data), ""); err != nil {
+			return err
+		}
+	}
+
+	updates := make(map[string]interface{}, len(merged))
+	for k, v := range merged {
+		updates[k] = applyChanges(before[k], v)
+	}
+	execCtx.Merge(updates)
+	return nil
+}
+
+// changedLeaves returns the parts of data that differ from before, keeping
+// the nesting of objects
+func changedLeaves(before, data map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for k, v := range data {
+		previous, existed := before[k]
+		previousObject, wasObject := previous.(map[string]interface{})
+		object, isObject := v.(map[string]interface{})
+		switch {
+		case wasObject && isObject:
+			if nested := changedLeaves(previousObject, object); len(nested) > 0 {
+				changes[k] = nested
+			}
+		case !existed || !reflect.DeepEqual(previous, v):
+			changes[k] = v
+		}
+	}
+	return changes
+}
+
+// mergeChanges merges the changes of one chain into merged, following the
+// state's policy where two chains wrote different values to the same leaf
+func mergeChanges(state core.StateDefinition, merged, changes map[string]interface{}, prefix string) error {
+	for k, v := range changes {
+		path := prefix + k
+		previous, exists := merged[k]
+		previousObject, wasObject := previous.(map[string]interface{})
+		object, isObject := v.(map[string]interface{})
+		if wasObject && isObject {
+			if err := mergeChanges(state, previousObject, object, path+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		if exists && !reflect.DeepEqual(previous, v) {
+			if state.MergeConflicts == core.MergeFail {
+				return fmt.Errorf("state %s: concurrent chains wrote conflicting values for %q", state.Name, path)
+			}
+			log.Printf("State %s: concurrent chains wrote conflicting values for %q, keeping the last one", state.Name, path)
+		}
+		if isObject {
+			// Copied so merging a later chain does not modify this chain's data
+			v = applyChanges(nil, object)
+		}
+		merged[k] = v
+	}
+	return nil
+}
+
+// applyChanges returns current with changes applied, copying objects along
+// the way since other contexts may share them
+func applyChanges(current, changes interface{}) interface{} {
+	changedObject, ok := changes.(map[string]interface{})
+	if !ok {
+		return changes
+	}
+	currentObject, ok := current.(map[string]interface{})
+	if !ok {
+		currentObject = nil
+	}
+	result := make(map[string]interface{}, len(currentObject)+len(changedObject))
+	for k, v := range currentObject {
+		result[k] = v
+	}
+	for k, v := range changedObject {
+		result[k] = applyChanges(currentObject[k], v)
+	}
+	return result
+}
+
+// goroutinePanic keeps the first panic of the goroutines a state starts, so
+// it can be raised again on the goroutine waiting for them, where the caller
+// of the run can recover it, instead of crashing the process
+type goroutinePanic struct {
+	mu    sync.Mutex
+	value interface{}
+	stack []byte
+}
+
+// capture must be deferred directly by the goroutine. It cancels the
+// goroutine's siblings when it recovers a panic.
+func (p *goroutinePanic) capture(cancel context.CancelFunc) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.value == nil {
+		p.value, p.stack = value, debug.Stack()
+	}
+	cancel()
+}
+
+func (p *goroutinePanic) raise() {
+	if p.value != nil {
+		panic(fmt.Sprintf("%v\n\n%s", p.value, p.stack))
+	}
+}
@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+func TestMergeChainDataMergesLeaves(t *testing.T) {
+	execCtx := core.NewExecutionContextFrom(map[string]interface{}{
+		"out":   map[string]interface{}{"kept": 1},
+		"other": "x",
+	})
+	// Each chain reports the whole top-level object from its own clone
+	results := []*core.PrimitiveResult{
+		{Success: true, Data: map[string]interface{}{"out": map[string]interface{}{"kept": 1, "a": map[string]interface{}{"id": "A"}}}},
+		{Success: true, Data: map[string]interface{}{"out": map[string]interface{}{"kept": 1, "b": map[string]interface{}{"id": "B"}}}},
+	}
+
+	for _, policy := range []string{core.MergeLastWriteWins, core.MergeFail} {
+		target := execCtx.Clone()
+		if err := mergeChainData(core.StateDefinition{Name: "S", MergeConflicts: policy}, results, target); err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		want := map[string]interface{}{
+			"out": map[string]interface{}{
+				"kept": 1,
+				"a":    map[string]interface{}{"id": "A"},
+				"b":    map[string]interface{}{"id": "B"},
+			},
+			"other": "x",
+		}
+		if got := target.Snapshot(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", policy, got, want)
+		}
+	}
+}
+
+func TestMergeChainDataConflicts(t *testing.T) {
+	results := []*core.PrimitiveResult{
+		{Success: true, Data: map[string]interface{}{"out": map[string]interface{}{"status": "a"}}},
+		{Success: true, Data: map[string]interface{}{"out": map[string]interface{}{"status": "b"}}},
+	}
+
+	execCtx := core.NewExecutionContext()
+	err := mergeChainData(core.StateDefinition{Name: "S", MergeConflicts: core.MergeFail}, results, execCtx)
+	if err == nil || !strings.Contains(err.Error(), `"out.status"`) {
+		t.Errorf("got error %v, want a conflict on out.status", err)
+	}
+
+	err = mergeChainData(core.StateDefinition{Name: "S"}, results, execCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := execCtx.Lookup("out"); !reflect.DeepEqual(got, map[string]interface{}{"status": "b"}) {
+		t.Errorf("got %v, want the last chain's value", got)
+	}
+}
@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// shouldRetry decides whether a failed attempt is retried under policy.
+// Cancellation and interruption of the run are never retried, and errors implementing
+// core.RetryableError, including a *core.Error set on a failed result,
+// override the policy's classification.
+func shouldRetry(ctx context.Context, policy *core.RetryPolicy, attempt int, result *core.PrimitiveResult, err error) bool {
+	if policy == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || errors.Is(err, ErrInterrupted) {
+		return false
+	}
+
+	if err == nil {
+		// A failure that routes elsewhere is a decision, not something to retry
+		if result == nil || result.Success || result.Routes() {
+			return false
+		}
+		if result.Error != nil {
+			return result.Error.Retryable()
+		}
+		return policy.RetriesOn(core.RetryOnFailure)
+	}
+
+	var retryable core.RetryableError
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return policy.RetriesOn(core.RetryOnTimeout)
+	}
+	return policy.RetriesOn(core.RetryOnError)
+}
+
+// waitBackoff sleeps before the given retry unless ctx ends first. A pause or
+// cancel of the run, pending or arriving during the sleep, stops the retries
+// with an *InterruptedError so the state runs again on resume.
+func waitBackoff(ctx context.Context, policy *core.RetryPolicy, retry int) error {
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	delay := policy.Backoff(retry)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-controlDone(ctx):
+			if err := interrupted(ctx); err != nil {
+				return err
+			}
+			// The request was withdrawn already; keep waiting
+		}
+	}
+}
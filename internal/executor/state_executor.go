@@ -1,6 +1,13 @@
 package executor
 
-import "github.com/aliatli/reactor/internal/core"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliatli/reactor/internal/core"
+	"github.com/aliatli/reactor/internal/expr"
+)
 
 type StateExecutor struct {
 	StateDefinitions map[string]core.StateDefinition
@@ -14,35 +21,177 @@ func NewStateExecutor() *StateExecutor {
 	}
 }
 
-func (se *StateExecutor) ExecuteState(stateName string, context *core.ExecutionContext) (string, error) {
+// ExecuteState runs the state's actions and returns the transition to take.
+// Timeouts of the state or of its primitives follow the failure transition
+// with a *TimeoutError. A state retry policy re-runs all of the state's
+// actions, including chains that already succeeded. A primitive returning an
+// Outcome ends the state and follows the transition declared for it; one
+// setting NextState routes the run there, provided the state lists it in
+// AllowedNextStates. When the state succeeds its guards pick the transition,
+// falling back to the success transition. A state failing with a coded error,
+// such as a *core.Error returned by a primitive or set on its result, follows
+// the error transition declared for the code, if any.
+func (se *StateExecutor) ExecuteState(ctx context.Context, stateName string, execCtx *core.ExecutionContext) (target string, err error) {
 	state, exists := se.StateDefinitions[stateName]
 	if !exists {
 		return "", nil
 	}
 
-	// Execute preliminary actions in order
-	for _, chain := range state.PreliminaryActions {
-		result, err := se.ChainExecutor.Execute(chain, context)
+	var result *core.PrimitiveResult
+	for attempt := 1; ; attempt++ {
+		startedAt := time.Now()
+		result, err = se.executeAttempt(ctx, state, execCtx)
+		if state.Retry != nil {
+			recordAttempt(ctx, "", attempt, startedAt, 0, result.Success, err)
+		}
+
+		if !shouldRetry(ctx, state.Retry, attempt, result, err) {
+			break
+		}
+		if waitErr := waitBackoff(ctx, state.Retry, attempt); waitErr != nil {
+			return failureTransition(state, waitErr), waitErr
+		}
+	}
+
+	defer func() {
+		recordEvent(ctx, stateFinished(result, err))
+	}()
+
+	if err != nil {
+		return failureTransition(state, err), err
+	}
+	if result.NextState != "" {
+		if !state.AllowsNextState(result.NextState) {
+			err = fmt.Errorf("state %s does not allow next state %s", state.Name, result.NextState)
+			return failureTransition(state, err), err
+		}
+		return result.NextState, nil
+	}
+	if result.Outcome != "" {
+		target, declared := state.Transitions[result.Outcome]
+		if !declared {
+			err = fmt.Errorf("state %s has no transition for outcome %s", state.Name, result.Outcome)
+			return failureTransition(state, err), err
+		}
+		return target, nil
+	}
+	if !result.Success {
+		if result.Error != nil {
+			// A typed failure is reported like an error so it ends up in the run result
+			err = result.Error
+		}
+		return failureTransition(state, err), err
+	}
+
+	target, err = evaluateGuards(state, execCtx)
+	if err != nil {
+		return failureTransition(state, err), err
+	}
+	if target != "" {
+		return target, nil
+	}
+	return state.Transitions[core.OutcomeSuccess], nil
+}
+
+// failureTransition returns the transition a state takes when it fails with
+// err: the error transition for err's code when the state declares one, and
+// the failure transition otherwise
+func failureTransition(state core.StateDefinition, err error) string {
+	if code := core.ErrorCode(err); code != "" {
+		if target, declared := state.ErrorTransitions[code]; declared {
+			return target
+		}
+	}
+	return state.Transitions[core.OutcomeFailure]
+}
+
+// evaluateGuards returns the target of the first guard that holds, or an
+// empty string when none do
+func evaluateGuards(state core.StateDefinition, execCtx *core.ExecutionContext) (string, error) {
+	data := execCtx.Snapshot()
+	for _, guard := range state.Guards {
+		expression, err := expr.Compile(guard.Expression)
 		if err != nil {
-			return string(state.Transitions.Failure), err
+			return "", fmt.Errorf("state %s: guard %q: %w", state.Name, guard.Expression, err)
 		}
-		if !result.Success {
-			return string(state.Transitions.Failure), nil
+		matched, err := expression.EvalBool(data)
+		if err != nil {
+			return "", fmt.Errorf("state %s: guard %q: %w", state.Name, guard.Expression, err)
+		}
+		if matched {
+			return guard.Target, nil
+		}
+	}
+	return "", nil
+}
+
+// executeAttempt runs the state's actions once under the state timeout
+func (se *StateExecutor) executeAttempt(ctx context.Context, state core.StateDefinition, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	stateCtx := ctx
+	timeout := state.Timeout.Duration()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		stateCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := se.executeActions(stateCtx, state, execCtx)
+	if err != nil && stateCtx.Err() != nil {
+		err = contextError(ctx, stateCtx, "state", state.Name, timeout)
+	}
+	return result, err
+}
+
+// executeActions runs the state's chains and main action, applying the
+// state's data mapping to primitives without their own. The returned
+// result is never nil; it is unsuccessful when an action failed and carries
+// the next state chosen by a primitive, if any.
+func (se *StateExecutor) executeActions(ctx context.Context, state core.StateDefinition, execCtx *core.ExecutionContext) (*core.PrimitiveResult, error) {
+	chains := make([]core.PrimitiveChain, len(state.PreliminaryActions))
+	for i, chain := range state.PreliminaryActions {
+		chains[i] = state.MappedChain(chain)
+	}
+
+	// Execute preliminary actions by execution order
+	for _, group := range groupChains(chains) {
+		var result *core.PrimitiveResult
+		var err error
+		if len(group) > 1 {
+			result, err = se.executeConcurrently(ctx, state, group, execCtx)
+		} else {
+			result, err = se.ChainExecutor.Execute(ctx, group[0], execCtx)
+		}
+		if err != nil {
+			return &core.PrimitiveResult{}, err
+		}
+		if !result.Success || result.Routes() {
+			return result, nil
+		}
+	}
+
+	if state.Map != nil {
+		if err := se.executeMap(ctx, state, execCtx); err != nil {
+			return &core.PrimitiveResult{}, err
 		}
 	}
 
 	// Execute main action if present
 	if state.MainAction != "" {
-		result, err := se.ChainExecutor.Execute(core.PrimitiveChain{
+		chain := core.PrimitiveChain{
 			Primitives: []string{state.MainAction},
-		}, context)
-		if err != nil {
-			return string(state.Transitions.Failure), err
 		}
-		if !result.Success {
-			return string(state.Transitions.Failure), nil
+		if state.MainActionOptions != nil {
+			chain.Options = map[string]core.PrimitiveOptions{
+				state.MainAction: *state.MainActionOptions,
+			}
+		}
+
+		result, err := se.ChainExecutor.Execute(ctx, state.MappedChain(chain), execCtx)
+		if err != nil {
+			return &core.PrimitiveResult{}, err
 		}
+		return result, nil
 	}
 
-	return string(state.Transitions.Success), nil
+	return &core.PrimitiveResult{Success: true}, nil
 }
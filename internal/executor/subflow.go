@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aliatli/reactor/internal/core"
+)
+
+// ChildStart asks the caller of the runner to start the child run of a
+// sub-flow state. The parent waits until the child's ChildResult is handed
+// back in its checkpoint.
+type ChildStart struct {
+	StartState string
+	Input      map[string]interface{}
+}
+
+// ChildResult is how the child run of a sub-flow state ended
+type ChildResult struct {
+	Status RunStatus              `json:"status"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// startChild ends the run until the child run of its sub-flow state finishes
+func (fr *FlowRunner) startChild(result *RunResult, checkpoint *Checkpoint, state core.StateDefinition, execCtx *core.ExecutionContext) (*RunResult, error) {
+	input, err := core.MapData(state.SubFlow.Input, execCtx.Snapshot())
+	if err != nil {
+		return nil, fmt.Errorf("sub-flow input: %w", err)
+	}
+
+	result.Status = RunStatusWaiting
+	result.Checkpoint = checkpoint
+	result.StartChild = &ChildStart{StartState: state.SubFlow.StartState, Input: input}
+	return result, nil
+}
+
+// finishSubFlow copies the outputs of a completed child run into the
+// context and executes the state; a child that did not complete fails it
+func (fr *FlowRunner) finishSubFlow(ctx context.Context, state core.StateDefinition, child *ChildResult, execCtx *core.ExecutionContext) (string, error) {
+	if child.Status != RunStatusCompleted {
+		err := fmt.Errorf("sub-flow %s ended %s", state.SubFlow.StartState, child.Status)
+		if child.Error != "" {
+			err = fmt.Errorf("%w: %s", err, child.Error)
+		}
+		return failureTransition(state, err), err
+	}
+
+	output, err := core.MapData(state.SubFlow.Output, child.Data)
+	if err != nil {
+		return failureTransition(state, err), fmt.Errorf("sub-flow output: %w", err)
+	}
+	execCtx.Merge(output)
+	return fr.StateExecutor.ExecuteState(ctx, state.Name, execCtx)
+}
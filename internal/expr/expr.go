@@ -0,0 +1,291 @@
+// Package expr implements the small expression language used by guarded
+// transitions. Expressions read values from execution context data through
+// dotted paths and support comparison, boolean and arithmetic operators:
+//
+//	order.amount > 1000 && order.items[0].id != "GIFT"
+//
+// A path may also start at $, the data itself, as in $.order.amount.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Expression is a compiled expression that can be evaluated repeatedly
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses source into an Expression
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", next.text, next.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against data. Paths that do not exist
+// evaluate to nil.
+func (e *Expression) Eval(data map[string]interface{}) (interface{}, error) {
+	return e.root.eval(data)
+}
+
+// EvalBool evaluates the expression and requires a boolean result
+func (e *Expression) EvalBool(data map[string]interface{}) (bool, error) {
+	value, err := e.Eval(data)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q evaluated to %v, not a boolean", e.source, value)
+	}
+	return result, nil
+}
+
+type node interface {
+	eval(data map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+// pathNode looks up a value by a chain of map keys and slice indexes
+type pathNode struct {
+	segments []interface{} // string keys or int indexes
+}
+
+func (n *pathNode) eval(data map[string]interface{}) (interface{}, error) {
+	var current interface{} = data
+	for _, segment := range n.segments {
+		current = lookup(current, segment)
+		if current == nil {
+			return nil, nil
+		}
+	}
+	return normalize(current), nil
+}
+
+func lookup(container interface{}, segment interface{}) interface{} {
+	value := reflect.ValueOf(container)
+	switch value.Kind() {
+	case reflect.Map:
+		key, ok := segment.(string)
+		if !ok || value.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		item := value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+		if !item.IsValid() {
+			return nil
+		}
+		return item.Interface()
+	case reflect.Slice, reflect.Array:
+		index, ok := segment.(int)
+		if !ok || index < 0 || index >= value.Len() {
+			return nil
+		}
+		return value.Index(index).Interface()
+	}
+	return nil
+}
+
+type unaryNode struct {
+	operator string
+	operand  node
+}
+
+func (n *unaryNode) eval(data map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "!":
+		b, err := toBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return !b, nil
+	case "-":
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %v", value)
+		}
+		return -number, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.operator)
+}
+
+type binaryNode struct {
+	operator    string
+	left, right node
+}
+
+func (n *binaryNode) eval(data map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Boolean operators short-circuit
+	switch n.operator {
+	case "&&", "||":
+		l, err := toBool(left)
+		if err != nil {
+			return nil, err
+		}
+		if (n.operator == "&&" && !l) || (n.operator == "||" && l) {
+			return l, nil
+		}
+		right, err := n.right.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right)
+	}
+
+	right, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.operator, left, right)
+	default:
+		return arithmetic(n.operator, left, right)
+	}
+}
+
+func compare(operator string, left, right interface{}) (bool, error) {
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %v %s %v", left, operator, right)
+		}
+		cmp = compareOrdered(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %v %s %v", left, operator, right)
+		}
+		cmp = compareOrdered(l, r)
+	default:
+		return false, fmt.Errorf("cannot compare %v %s %v", left, operator, right)
+	}
+
+	switch operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareOrdered[T float64 | string](l, r T) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func arithmetic(operator string, left, right interface{}) (interface{}, error) {
+	if operator == "+" {
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %v and %v", operator, left, right)
+	}
+
+	switch operator {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if operator == "%" {
+			return math.Mod(l, r), nil
+		}
+		return l / r, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", operator)
+}
+
+// toBool treats a missing value as false and rejects anything but booleans
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+// normalize converts numeric types to float64, and named string and bool
+// types to their base type, so values from Go primitives and from decoded
+// JSON compare alike
+func normalize(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return value
+}
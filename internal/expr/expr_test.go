@@ -0,0 +1,207 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := tokenize(`a.b[0] >= 1.5 && $.c != 'x\'y'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.text)
+	}
+	want := []string{"a", ".", "b", "[", "0", "]", ">=", "1.5", "&&", "$", ".", "c", "!=", `'x\'y'`, ""}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("got tokens %q, want %q", texts, want)
+	}
+	if value := tokens[13].value; value != "x'y" {
+		t.Errorf("got string value %q, want %q", value, "x'y")
+	}
+}
+
+func TestTokenizeNumbers(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{`12.5`, []string{"12.5", ""}},
+		{`1.x`, []string{"1", ".", "x", ""}},
+		{`a[0].b`, []string{"a", "[", "0", "]", ".", "b", ""}},
+		{`çay2 + 1`, []string{"çay2", "+", "1", ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			tokens, err := tokenize(test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var texts []string
+			for _, token := range tokens {
+				texts = append(texts, token.text)
+			}
+			if !reflect.DeepEqual(texts, test.want) {
+				t.Errorf("got tokens %q, want %q", texts, test.want)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	data := map[string]interface{}{
+		"order": map[string]interface{}{
+			"amount": 1500,
+			"items":  []interface{}{map[string]interface{}{"id": "GIFT"}, map[string]interface{}{"id": "A"}},
+			"status": "paid",
+		},
+		"flags":   map[string]bool{"vip": true},
+		"n":       7.0,
+		"müşteri": map[string]interface{}{"adı": "Ayşe"},
+	}
+
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// Literals and paths
+		{`42`, 42.0},
+		{`"paid"`, "paid"},
+		{`true`, true},
+		{`null`, nil},
+		{`order.amount`, 1500.0},
+		{`order.items[1].id`, "A"},
+		{`order["status"]`, "paid"},
+		{`$.order.amount`, 1500.0},
+		{`$["order"].items[0]["id"]`, "GIFT"},
+		{`flags.vip`, true},
+		{`order.missing.deeper`, nil},
+		{`order.items[5]`, nil},
+		{`müşteri.adı`, "Ayşe"},
+		{`müşteri.adı == "Ayşe"`, true},
+		{`order.items[1.0].id`, "A"},
+
+		// Precedence and associativity
+		{`1 + 2 * 3`, 7.0},
+		{`(1 + 2) * 3`, 9.0},
+		{`10 - 4 - 3`, 3.0},
+		{`8 / 4 / 2`, 1.0},
+		{`-n + 1`, -6.0},
+		{`!false && false`, false},
+		{`true || false && false`, true},
+		{`1 + 1 == 2 && "a" < "b"`, true},
+
+		// Arithmetic
+		{`n % 4`, 3.0},
+		{`n % 0.5`, 0.0},
+		{`7.5 % 2`, 1.5},
+		{`"a" + "b"`, "ab"},
+
+		// Comparisons
+		{`order.amount > 1000 && order.items[0].id == "GIFT"`, true},
+		{`order.status != "paid"`, false},
+		{`order.amount <= 1500`, true},
+		{`order.missing == null`, true},
+		{`!order.missing`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			expression, err := Compile(test.source)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			got, err := expression.Eval(data)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`a >`, "unexpected end of expression"},
+		{`(a`, `expected ")"`},
+		{`a b`, `unexpected "b"`},
+		{`a.1`, "expected a field name"},
+		{`a[b]`, "expected an index or a quoted key"},
+		{`"open`, "unterminated string"},
+		{`a # b`, "unexpected character"},
+		{`1.2.3`, `invalid number "1.2.3"`},
+		{`a[1.7]`, "index 1.7 at position 2 is not an integer"},
+		{`a[99999999999]`, "out of range"},
+		{`a ∑ b`, `unexpected character '∑' at position 2`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := Compile(test.source)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	data := map[string]interface{}{"n": 3, "s": "x", "zero": 0}
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`n / 0`, "division by zero"},
+		{`n % zero`, "division by zero"},
+		{`n + s`, "cannot apply +"},
+		{`s * 2`, "cannot apply *"},
+		{`-s`, "cannot negate"},
+		{`n < s`, "cannot compare"},
+		{`true > false`, "cannot compare"},
+		{`!n`, "is not a boolean"},
+		{`n && true`, "is not a boolean"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			expression, err := Compile(test.source)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			_, err = expression.Eval(data)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	expression, err := Compile(`n + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expression.EvalBool(map[string]interface{}{"n": 1}); err == nil {
+		t.Error("expected an error for a non-boolean result")
+	}
+
+	expression, err = Compile(`false && n > "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// && short-circuits before the ill-typed comparison
+	got, err := expression.EvalBool(map[string]interface{}{"n": 1})
+	if err != nil || got {
+		t.Errorf("got %v, %v, want false, nil", got, err)
+	}
+}
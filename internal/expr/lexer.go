@@ -0,0 +1,132 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// operators is ordered so that longer operators are matched first
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ".", "[", "]",
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for pos < len(source) {
+		c, size := utf8.DecodeRuneInString(source[pos:])
+		switch {
+		case unicode.IsSpace(c):
+			pos += size
+
+		case isDigit(c):
+			start := pos
+			pos = skipDigits(source, pos)
+			// A fraction needs digits after its point
+			if pos+1 < len(source) && source[pos] == '.' && isDigit(rune(source[pos+1])) {
+				pos = skipDigits(source, pos+1)
+				if pos < len(source) && source[pos] == '.' {
+					end := skipDigits(source, pos+1)
+					return nil, fmt.Errorf("invalid number %q at position %d", source[start:end], start)
+				}
+			}
+			value, err := strconv.ParseFloat(source[start:pos], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", source[start:pos], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:pos], value: value, pos: start})
+
+		case c == '"' || c == '\'':
+			start := pos
+			value, end, err := readString(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			tokens = append(tokens, token{kind: tokenString, text: source[start:pos], value: value, pos: start})
+
+		case c == '$':
+			tokens = append(tokens, token{kind: tokenIdent, text: "$", pos: pos})
+			pos++
+
+		case c == '_' || unicode.IsLetter(c):
+			start := pos
+			for pos < len(source) {
+				c, size := utf8.DecodeRuneInString(source[pos:])
+				if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					break
+				}
+				pos += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:pos], pos: start})
+
+		default:
+			operator := ""
+			for _, op := range operators {
+				if strings.HasPrefix(source[pos:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, pos)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: pos})
+			pos += len(operator)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// isDigit reports whether c is an ASCII digit, the only digits numbers may use
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+// skipDigits returns the position of the first non-digit at or after pos
+func skipDigits(source string, pos int) int {
+	for pos < len(source) && isDigit(rune(source[pos])) {
+		pos++
+	}
+	return pos
+}
+
+// readString reads a quoted string starting at pos and returns its value and
+// the position after the closing quote
+func readString(source string, pos int) (string, int, error) {
+	quote := source[pos]
+	var value strings.Builder
+	for i := pos + 1; i < len(source); i++ {
+		switch source[i] {
+		case quote:
+			return value.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(source) {
+				i++
+			}
+		}
+		value.WriteByte(source[i])
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", pos)
+}
@@ -0,0 +1,189 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+)
+
+// parser is a recursive descent parser. From lowest to highest precedence:
+// ||, &&, comparison, + and -, * / and %, unary ! and -, then literals,
+// paths and parenthesized expressions.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators
+func (p *parser) accept(operators ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range operators {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(operator string) error {
+	if _, ok := p.accept(operator); !ok {
+		t := p.peek()
+		return fmt.Errorf("expected %q at position %d, found %q", operator, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("==", "!=", "<=", ">=", "<", ">"); ok {
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{operator: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+// parseBinary parses a left-associative sequence of operands joined by operators
+func (p *parser) parseBinary(operand func() (node, error), operators ...string) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(operators...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &literalNode{value: t.value}, nil
+
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		return p.parsePath(t.text)
+
+	case tokenOperator:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+// parsePath parses the rest of a path such as order.items[0]["id"]. Paths
+// may start at the root of the data in JSONPath style, as in $.order.id.
+func (p *parser) parsePath(first string) (node, error) {
+	path := &pathNode{}
+	if first != "$" {
+		path.segments = append(path.segments, first)
+	}
+	for {
+		if _, ok := p.accept("."); ok {
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a field name at position %d", t.pos)
+			}
+			path.segments = append(path.segments, t.text)
+			continue
+		}
+
+		if _, ok := p.accept("["); ok {
+			t := p.next()
+			switch t.kind {
+			case tokenNumber:
+				index := t.value.(float64)
+				if index != math.Trunc(index) {
+					return nil, fmt.Errorf("index %s at position %d is not an integer", t.text, t.pos)
+				}
+				if index > math.MaxInt32 {
+					return nil, fmt.Errorf("index %s at position %d is out of range", t.text, t.pos)
+				}
+				path.segments = append(path.segments, int(index))
+			case tokenString:
+				path.segments = append(path.segments, t.value)
+			default:
+				return nil, fmt.Errorf("expected an index or a quoted key at position %d", t.pos)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return path, nil
+	}
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Run struct {
+	gorm.Model
+	StartState    string
+	CurrentState  string
+	Status        string                 `gorm:"index"`
+	Path          []string               `gorm:"serializer:json"`
+	Context       map[string]interface{} `gorm:"serializer:json"`
+	Attempts      []Attempt              `gorm:"serializer:json"`
+	Compensations []Compensation         `gorm:"serializer:json"`
+	Error         string
+	// Failure is the coded error the run failed with, if any
+	Failure *Failure `gorm:"serializer:json"`
+	// Checkpoint fields used to resume the run after a restart
+	CompletedSteps []CompletedStep `gorm:"serializer:json"`
+	LastError      string
+	LastFailure    *Failure `gorm:"serializer:json"`
+	// WakeAt is when a waiting run's timer fires or its signal wait times out
+	WakeAt         *time.Time `gorm:"index"`
+	ReceivedSignal string
+	ChildResult    *ChildResult `gorm:"serializer:json"`
+	// Sub-flow links between parent and child runs
+	ParentRunID *uint  `gorm:"index"`
+	ChildRunIDs []uint `gorm:"serializer:json"`
+	// IdempotencyKey is set by clients retrying the request that started the
+	// run. It is only written on create so saving a run cannot bring back a
+	// key released to a newer run.
+	IdempotencyKey *string `gorm:"uniqueIndex;<-:create"`
+}
+
+// RunStep queues a run for a worker to execute from its checkpoint until it
+// finishes or stops to wait. A run has at most one step. Workers hold a lease
+// on the step they execute, and steps whose lease expired, e.g. because their
+// worker died, are claimed again.
+type RunStep struct {
+	ID    uint `gorm:"primarykey"`
+	RunID uint `gorm:"uniqueIndex"`
+	// Cancel starts the run with a cancel request pending
+	Cancel         bool
+	CreatedAt      time.Time
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time `gorm:"index"`
+}
+
+// RunSignal is a signal sent to a run before it reached the state waiting for
+// it. The run receives it, oldest first, once it enters that state.
+type RunSignal struct {
+	ID        uint `gorm:"primarykey"`
+	RunID     uint `gorm:"index"`
+	Name      string
+	Payload   map[string]interface{} `gorm:"serializer:json"`
+	CreatedAt time.Time
+}
+
+// RunEvent is an entry of a run's execution history. A run's events are
+// ordered by ID.
+type RunEvent struct {
+	ID        uint `gorm:"primarykey"`
+	RunID     uint `gorm:"index"`
+	Type      string
+	Time      time.Time
+	State     string
+	Primitive string
+	Attempt   int
+	Success   bool
+	Duration  time.Duration
+	Waited    time.Duration
+	Data      map[string]interface{} `gorm:"serializer:json"`
+	Error     string
+	ErrorCode string
+	Target    string
+	Status    string
+}
+
+type Failure struct {
+	Code      string
+	Message   string
+	Transient bool
+	Details   map[string]interface{}
+}
+
+type Attempt struct {
+	State     string
+	Primitive string
+	Number    int
+	Success   bool
+	Error     string
+	StartedAt time.Time
+	Duration  time.Duration
+	Waited    time.Duration
+}
+
+type Compensation struct {
+	State        string
+	Primitive    string
+	Compensation string
+	Success      bool
+	Error        string
+	StartedAt    time.Time
+	Duration     time.Duration
+}
+
+type CompletedStep struct {
+	State        string
+	Primitive    string
+	Compensation string
+}
+
+type ChildResult struct {
+	Status string
+	Data   map[string]interface{}
+	Error  string
+}
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Edge struct {
 	Source       string `json:"source"`
@@ -13,14 +17,88 @@ type State struct {
 	Name               string           `gorm:"uniqueIndex"`
 	PreliminaryActions []PrimitiveChain `gorm:"serializer:json"`
 	MainAction         string
+	MainActionOptions  *PrimitiveOptions `gorm:"serializer:json"`
+	Timeout            time.Duration
+	Retry              *RetryPolicy   `gorm:"serializer:json"`
+	Timer              *Timer         `gorm:"serializer:json"`
+	WaitFor            *WaitForSignal `gorm:"serializer:json"`
+	SubFlow            *SubFlow       `gorm:"serializer:json"`
+	Map                *Map           `gorm:"serializer:json"`
+	DataMapping        *DataMapping   `gorm:"serializer:json"`
+	MergeConflicts     string
+	MaxVisits          int
+	AllowedNextStates  []string `gorm:"serializer:json"`
 	PositionX          float64
 	PositionY          float64
-	SuccessTransition  string
-	FailureTransition  string
-	Edges              []Edge `gorm:"serializer:json"`
+	Terminal           string
+	Transitions        map[string]string `gorm:"serializer:json"`
+	ErrorTransitions   map[string]string `gorm:"serializer:json"`
+	Guards             []Guard           `gorm:"serializer:json"`
+	Edges              []Edge            `gorm:"serializer:json"`
+}
+
+// FlowSettings holds the settings of the flow as a whole in a single row
+type FlowSettings struct {
+	gorm.Model
+	MaxVisits      int
+	MaxTransitions int
+}
+
+type Guard struct {
+	Expression string
+	Target     string
 }
 
 type PrimitiveChain struct {
 	Primitives     []string
 	ExecutionOrder int
+	Options        map[string]PrimitiveOptions
+}
+
+type PrimitiveOptions struct {
+	Timeout      time.Duration
+	Retry        *RetryPolicy
+	Compensation string
+	DataMapping  *DataMapping
+}
+
+type Timer struct {
+	Delay time.Duration
+	Until string
+	Cron  string
+}
+
+type WaitForSignal struct {
+	Signal  string
+	Timeout time.Duration
+}
+
+type SubFlow struct {
+	StartState string
+	Input      map[string]string
+	Output     map[string]string
+}
+
+type DataMapping struct {
+	Input      map[string]string
+	OutputPath string
+}
+
+type Map struct {
+	Items             string
+	ItemKey           string
+	Chain             *PrimitiveChain
+	StartState        string
+	MaxConcurrency    int
+	ToleratedFailures int
+	ResultKey         string
+}
+
+type RetryPolicy struct {
+	MaxAttempts        int
+	InitialInterval    time.Duration
+	MaxInterval        time.Duration
+	BackoffCoefficient float64
+	Jitter             float64
+	RetryOn            []string
 }
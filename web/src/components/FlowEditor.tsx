@@ -13,7 +13,7 @@ import ReactFlow, {
     Edge as ReactFlowEdge
 } from 'reactflow';
 import 'reactflow/dist/style.css';
-import { StateDefinition } from '../types/flow';
+import { PrimitiveChain, StateDefinition } from '../types/flow';
 import { PrimitivePanel } from './PrimitivePanel';
 import { Edge as CustomEdge } from '../types/flow';
 
@@ -23,6 +23,69 @@ interface FlowEditorProps {
     onStateCreated?: () => void;
 }
 
+const DEFAULT_OUTCOMES = ['success', 'failure'];
+
+// Outcomes a state declares, in the order their handles are drawn
+const stateOutcomes = (state?: StateDefinition): string[] => {
+    const outcomes = Object.keys(state?.transitions || {});
+    return outcomes.length > 0 ? outcomes : DEFAULT_OUTCOMES;
+};
+
+const outcomeColor = (outcome?: string | null) => {
+    switch (outcome) {
+        case 'success':
+            return '#4CAF50';
+        case 'failure':
+            return '#f44336';
+        default:
+            return '#2196F3';
+    }
+};
+
+const outcomeLabel = (outcome?: string | null) => {
+    switch (outcome) {
+        case 'success':
+            return 'Success';
+        case 'failure':
+            return 'Failure';
+        default:
+            return outcome || '';
+    }
+};
+
+// Transition per outcome, taken from the edges leaving the node
+const buildTransitions = (outcomes: string[], nodeId: string, edges: ReactFlowEdge[]) =>
+    outcomes.reduce((acc, outcome) => {
+        acc[outcome] = edges.find(e => e.source === nodeId && e.sourceHandle === outcome)?.target || 'none';
+        return acc;
+    }, {} as Record<string, string>);
+
+// Primitives of all the state's chains, in execution order
+const chainPrimitives = (state?: StateDefinition) =>
+    Array.from(new Set([...(state?.preliminaryActions || [])]
+        .sort((a, b) => a.executionOrder - b.executionOrder)
+        .flatMap(chain => chain.primitives)));
+
+// Applies the primitives selected in the panel to a state's chains. Chains
+// keep their order and options; deselected primitives leave their chain and
+// newly selected ones run in a chain after the existing ones.
+const applySelection = (chains: PrimitiveChain[], selected: string[]): PrimitiveChain[] => {
+    const kept = chains
+        .map(chain => {
+            const primitives = chain.primitives.filter(p => selected.includes(p));
+            const options = chain.options && Object.fromEntries(
+                Object.entries(chain.options).filter(([primitive]) => primitives.includes(primitive)));
+            return { ...chain, primitives, options };
+        })
+        .filter(chain => chain.primitives.length > 0);
+
+    const existing = new Set(kept.flatMap(chain => chain.primitives));
+    const added = selected.filter(p => !existing.has(p));
+    if (added.length === 0) return kept;
+    const lastOrder = Math.max(0, ...kept.map(chain => chain.executionOrder));
+    return [...kept, { primitives: added, executionOrder: lastOrder + 1 }];
+};
+
 // Custom node component
 const StateNode: React.FC<NodeProps> = ({ data, id }) => (
     <div 
@@ -59,18 +122,19 @@ const StateNode: React.FC<NodeProps> = ({ data, id }) => (
             style={{ background: '#555' }}
         />
         <div>{data.label}</div>
-        <Handle
-            type="source"
-            position={Position.Bottom}
-            id="success"
-            style={{ background: '#4CAF50', bottom: 10 }}
-        />
-        <Handle
-            type="source"
-            position={Position.Bottom}
-            id="failure"
-            style={{ background: '#f44336' }}
-        />
+        {(data.outcomes as string[]).map((outcome, index, outcomes) => (
+            <Handle
+                key={outcome}
+                type="source"
+                position={Position.Bottom}
+                id={outcome}
+                title={outcomeLabel(outcome)}
+                style={{
+                    background: outcomeColor(outcome),
+                    left: `${((index + 1) / (outcomes.length + 1)) * 100}%`
+                }}
+            />
+        ))}
     </div>
 );
 
@@ -105,8 +169,7 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
             // First update all connected states
             const updatePromises = states.map(state => {
                 if (state.name !== stateId && (
-                    state.transitions.success === stateId || 
-                    state.transitions.failure === stateId ||
+                    Object.values(state.transitions || {}).includes(stateId) ||
                     state.edges?.some(e => e.source === stateId || e.target === stateId)
                 )) {
                     const updatedState: StateDefinition = {
@@ -114,10 +177,11 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                         edges: (state.edges || []).filter(edge => 
                             edge.source !== stateId && edge.target !== stateId
                         ),
-                        transitions: {
-                            success: state.transitions.success === stateId ? 'none' : state.transitions.success,
-                            failure: state.transitions.failure === stateId ? 'none' : state.transitions.failure
-                        }
+                        transitions: Object.fromEntries(
+                            Object.entries(state.transitions || {}).map(([outcome, target]) =>
+                                [outcome, target === stateId ? 'none' : target]
+                            )
+                        )
                     };
 
                     return fetch('http://localhost:8080/api/states', {
@@ -156,6 +220,7 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
             type: 'stateNode',
             data: { 
                 label: state.name,
+                outcomes: stateOutcomes(state),
                 onDelete: handleDeleteState,
                 onSelect: handleStateSelect
             },
@@ -171,8 +236,8 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                     source: edge.source,
                     target: edge.target,
                     sourceHandle: edge.sourceHandle,
-                    style: { stroke: edge.sourceHandle === 'success' ? '#4CAF50' : '#f44336' },
-                    label: edge.sourceHandle === 'success' ? 'Success' : 'Failure'
+                    style: { stroke: outcomeColor(edge.sourceHandle) },
+                    label: outcomeLabel(edge.sourceHandle)
                 }))
         ), [states]);
 
@@ -185,6 +250,7 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                 type: 'stateNode',
                 data: { 
                     label: state.name,
+                    outcomes: stateOutcomes(state),
                     onDelete: handleDeleteState,
                     onSelect: handleStateSelect
                 },
@@ -201,8 +267,8 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                     sourceHandle: edge.sourceHandle,
                     type: 'default',
                     animated: false,
-                    style: { stroke: edge.sourceHandle === 'success' ? '#4CAF50' : '#f44336' },
-                    label: edge.sourceHandle === 'success' ? 'Success' : 'Failure'
+                    style: { stroke: outcomeColor(edge.sourceHandle) },
+                    label: outcomeLabel(edge.sourceHandle)
                 }))
             );
 
@@ -224,13 +290,22 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                     sourceHandle: edge.sourceHandle,
                     type: 'default',
                     animated: false,
-                    style: { stroke: edge.sourceHandle === 'success' ? '#4CAF50' : '#f44336' },
-                    label: edge.sourceHandle === 'success' ? 'Success' : 'Failure'
+                    style: { stroke: outcomeColor(edge.sourceHandle) },
+                    label: outcomeLabel(edge.sourceHandle)
                 }))
             );
             setEdges(currentEdges);
+
+            // Keep each node's handles in sync with the outcomes its state declares
+            setNodes(nodes => nodes.map(node => ({
+                ...node,
+                data: {
+                    ...node.data,
+                    outcomes: stateOutcomes(states.find(s => s.name === node.id))
+                }
+            })));
         }
-    }, [states, isInitialized, setEdges]);
+    }, [states, isInitialized, setEdges, setNodes]);
 
     // Add a cleanup effect
     useEffect(() => {
@@ -248,18 +323,21 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
             .then(data => setPrimitives(data));
     }, []);
 
-    const handlePrimitiveSave = (selectedPrimitives: string[]) => {
+    const handlePrimitiveSave = (selectedPrimitives: string[], outcomes: string[]) => {
         if (!selectedState) return;
 
         const state = states.find(s => s.name === selectedState);
         if (!state) return;
 
+        // Keep the targets of outcomes that still exist and drop edges of removed ones
         const updatedState: StateDefinition = {
             ...state,
-            preliminaryActions: [{
-                primitives: selectedPrimitives,
-                executionOrder: 1
-            }]
+            preliminaryActions: applySelection(state.preliminaryActions || [], selectedPrimitives),
+            edges: (state.edges || []).filter(edge => outcomes.includes(edge.sourceHandle)),
+            transitions: outcomes.reduce((acc, outcome) => {
+                acc[outcome] = state.transitions?.[outcome] || 'none';
+                return acc;
+            }, {} as Record<string, string>)
         };
 
         fetch('http://localhost:8080/api/states', {
@@ -284,7 +362,6 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
             const sourceNode = nodes.find(n => n.id === connection.source);
             if (!sourceNode) return;
 
-            const isSuccess = connection.sourceHandle === 'success';
             const edge: CustomEdge = {
                 id: `${connection.source}-${connection.target}`,
                 source: connection.source,
@@ -292,8 +369,8 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                 sourceHandle: connection.sourceHandle,
                 type: 'default',
                 animated: false,
-                style: { stroke: isSuccess ? '#4CAF50' : '#f44336' },
-                label: isSuccess ? 'Success' : 'Failure'
+                style: { stroke: outcomeColor(connection.sourceHandle) },
+                label: outcomeLabel(connection.sourceHandle)
             };
 
             const existingState = states.find(s => s.name === connection.source);
@@ -308,8 +385,8 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                     sourceHandle: connection.sourceHandle,
                     type: 'default',
                     animated: false,
-                    style: { stroke: connection.sourceHandle === 'success' ? '#4CAF50' : '#f44336' },
-                    label: connection.sourceHandle === 'success' ? 'Success' : 'Failure'
+                    style: { stroke: outcomeColor(connection.sourceHandle) },
+                    label: outcomeLabel(connection.sourceHandle)
                 }]
             };
 
@@ -340,18 +417,17 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                 label: edge.label
             }));
 
+            // The editor owns positions, edges and transitions; everything
+            // else the state defines is kept as loaded
             acc[node.id] = {
+                ...states.find(s => s.name === node.id),
                 name: node.id,
                 position: {
                     x: node.position.x,
                     y: node.position.y
                 },
-                preliminaryActions: [],
                 edges: nodeEdges,
-                transitions: {
-                    success: edges.find(e => e.source === node.id && e.sourceHandle === 'success')?.target || 'none',
-                    failure: edges.find(e => e.source === node.id && e.sourceHandle === 'failure')?.target || 'none'
-                }
+                transitions: buildTransitions(node.data.outcomes, node.id, edges)
             };
             return acc;
         }, {} as Record<string, any>);
@@ -401,6 +477,7 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                 type: 'stateNode',
                 data: { 
                     label: newStateName,
+                    outcomes: DEFAULT_OUTCOMES,
                     onDelete: handleDeleteState,
                     onSelect: handleStateSelect
                 },
@@ -423,6 +500,7 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
         
         // Save the state with new position while preserving other data
         const stateDefinition: StateDefinition = {
+            ...existingState,
             name: node.id,
             position: {
                 x: node.position.x,
@@ -430,10 +508,7 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
             },
             preliminaryActions: existingState?.preliminaryActions || [],
             edges: existingState?.edges || [],
-            transitions: {
-                success: edges.find(e => e.source === node.id && e.sourceHandle === 'success')?.target || 'none',
-                failure: edges.find(e => e.source === node.id && e.sourceHandle === 'failure')?.target || 'none'
-            }
+            transitions: buildTransitions(stateOutcomes(existingState), node.id, edges)
         };
 
         fetch('http://localhost:8080/api/states', {
@@ -509,10 +584,8 @@ export const FlowEditor: React.FC<FlowEditorProps> = ({ states, onSave, onStateC
                 <PrimitivePanel
                     stateName={selectedState}
                     primitives={primitives}
-                    selectedPrimitives={
-                        states.find(s => s.name === selectedState)
-                            ?.preliminaryActions[0]?.primitives || []
-                    }
+                    selectedPrimitives={chainPrimitives(states.find(s => s.name === selectedState))}
+                    outcomes={stateOutcomes(states.find(s => s.name === selectedState))}
                     onClose={() => setSelectedState(null)}
                     onSave={handlePrimitiveSave}
                 />
@@ -4,18 +4,29 @@ interface PrimitivePanelProps {
     stateName: string;
     primitives: string[];
     selectedPrimitives: string[];
+    outcomes: string[];
     onClose: () => void;
-    onSave: (primitives: string[]) => void;
+    onSave: (primitives: string[], outcomes: string[]) => void;
 }
 
 export const PrimitivePanel: React.FC<PrimitivePanelProps> = ({
     stateName,
     primitives,
     selectedPrimitives,
+    outcomes,
     onClose,
     onSave,
 }) => {
     const [selected, setSelected] = React.useState<string[]>(selectedPrimitives);
+    const [stateOutcomes, setStateOutcomes] = React.useState<string[]>(outcomes);
+    const [newOutcome, setNewOutcome] = React.useState('');
+
+    const handleAddOutcome = () => {
+        const outcome = newOutcome.trim();
+        if (!outcome || stateOutcomes.includes(outcome)) return;
+        setStateOutcomes([...stateOutcomes, outcome]);
+        setNewOutcome('');
+    };
 
     return (
         <div style={{
@@ -55,9 +66,28 @@ export const PrimitivePanel: React.FC<PrimitivePanelProps> = ({
                 ))}
             </div>
 
+            <h4>Outcomes</h4>
+            <div style={{ marginBottom: '20px' }}>
+                {stateOutcomes.map(outcome => (
+                    <div key={outcome} style={{ display: 'flex', justifyContent: 'space-between', marginBottom: '5px' }}>
+                        <span>{outcome}</span>
+                        {outcome !== 'success' && outcome !== 'failure' && (
+                            <button onClick={() => setStateOutcomes(stateOutcomes.filter(o => o !== outcome))}>×</button>
+                        )}
+                    </div>
+                ))}
+                <input
+                    type="text"
+                    value={newOutcome}
+                    onChange={(e) => setNewOutcome(e.target.value)}
+                    placeholder="New outcome, e.g. approved"
+                />
+                <button onClick={handleAddOutcome} style={{ marginLeft: '5px' }}>Add</button>
+            </div>
+
             <div style={{ display: 'flex', justifyContent: 'flex-end', gap: '10px' }}>
                 <button onClick={onClose}>Cancel</button>
-                <button onClick={() => onSave(selected)}>Save</button>
+                <button onClick={() => onSave(selected, stateOutcomes)}>Save</button>
             </div>
         </div>
     );
@@ -10,18 +10,108 @@ export interface StateDefinition {
     name: string;
     preliminaryActions: PrimitiveChain[];
     mainAction?: string;
+    mainActionOptions?: PrimitiveOptions;
+    timeout?: string;
+    retry?: RetryPolicy;
+    timer?: Timer;
+    waitFor?: WaitForSignal;
+    subFlow?: SubFlow;
+    map?: MapState;
+    // Default data mapping for the state's primitives
+    dataMapping?: DataMapping;
+    mergeConflicts?: 'lastWriteWins' | 'fail';
+    // How often a run may enter the state, overriding the flow's maxVisits
+    maxVisits?: number;
+    allowedNextStates?: string[];
     position: {
         x: number;
         y: number;
     };
     edges?: Edge[];
-    transitions: {
-        success: string;
-        failure: string;
-    };
+    terminal?: 'success' | 'failure';
+    // Target state per outcome, e.g. { success: 'Shipped', failure: 'Cancelled', needs_info: 'AskCustomer' }
+    transitions: Record<string, string>;
+    // Target state per error code, e.g. { PAYMENT_DECLINED: 'Declined' }, taken instead of the failure transition
+    errorTransitions?: Record<string, string>;
+    guards?: Guard[];
+}
+
+// Transition taken when the expression holds, e.g. "order.amount > 1000"
+export interface Guard {
+    expression: string;
+    target: string;
+}
+
+// Wait before running the state's actions; set exactly one field
+export interface Timer {
+    delay?: string;
+    // Context path holding an RFC 3339 time, e.g. "order.remindAt"
+    until?: string;
+    // Five-field cron expression, e.g. "0 9 * * 1-5"
+    cron?: string;
+}
+
+// Park the run until the named signal is sent; without it in time the
+// run follows the "timeout" transition
+export interface WaitForSignal {
+    signal: string;
+    timeout?: string;
+}
+
+// Run another flow as a child run; input and output map context keys to
+// expressions, e.g. { amount: 'order.amount' }
+export interface SubFlow {
+    startState: string;
+    input?: Record<string, string>;
+    output?: Record<string, string>;
+}
+
+// Run a chain, or a flow from startState, per element of the items list;
+// results land in resultKey as { success, data, error } entries
+export interface MapState {
+    items: string;
+    itemKey?: string;
+    chain?: PrimitiveChain;
+    startState?: string;
+    maxConcurrency?: number;
+    toleratedFailures?: number;
+    resultKey?: string;
 }
 
 export interface PrimitiveChain {
     primitives: string[];
     executionOrder: number;
-} 
\ No newline at end of file
+    options?: Record<string, PrimitiveOptions>;
+}
+
+export interface PrimitiveOptions {
+    timeout?: string;
+    retry?: RetryPolicy;
+    compensation?: string;
+    dataMapping?: DataMapping;
+}
+
+// Selects what a primitive reads, e.g. { amount: '$.order.amount' }, and
+// where its data is written, e.g. '$.payment'
+export interface DataMapping {
+    input?: Record<string, string>;
+    outputPath?: string;
+}
+
+export interface RetryPolicy {
+    maxAttempts: number;
+    initialInterval?: string;
+    maxInterval?: string;
+    backoffCoefficient?: number;
+    jitter?: number;
+    retryOn?: ('error' | 'timeout' | 'failure')[];
+} 
+
+// Coded error a run failed with, as returned in a run's failure
+export interface RunFailure {
+    code: string;
+    message?: string;
+    // Set on failures that retrying may fix
+    transient?: boolean;
+    details?: Record<string, unknown>;
+}